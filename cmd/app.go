@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/pkg/config"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/mailer"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"github.com/NekruzRakhimov/todo_app/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
+)
+
+// app is the wiring shared by the server and the other commands.
+type app struct {
+	cfg      config.Config
+	db       *gorm.DB
+	replicas []*gorm.DB
+	repos    *repository.Repository
+	services *service.Service
+	runner   *jobs.Runner
+}
+
+// loadConfig reads configs/config.yml, or the file named by TODO_CONFIG.
+func loadConfig() (config.Config, error) {
+	return config.Load(os.Getenv("TODO_CONFIG"))
+}
+
+// openDB connects to the configured database; the memory driver has none.
+func openDB(cfg config.Config) (*gorm.DB, error) {
+	switch cfg.DB.Driver {
+	case "sqlite":
+		return repository.NewSQLiteDB(cfg.DB.SQLitePath)
+	case "memory":
+		return nil, nil
+	}
+
+	return repository.NewPostgresDB(postgresConfig(cfg))
+}
+
+func postgresConfig(cfg config.Config) repository.Config {
+	return repository.Config{
+		URL:      cfg.DB.URL,
+		Host:     cfg.DB.Host,
+		Port:     cfg.DB.Port,
+		Username: cfg.DB.Username,
+		Password: cfg.DB.Password,
+		DBName:   cfg.DB.DBName,
+		SSLMode:  cfg.DB.SSLMode,
+
+		StatementTimeout: cfg.DB.StatementTimeout,
+		MaxOpenConns:     cfg.DB.MaxOpenConns,
+		MaxIdleConns:     cfg.DB.MaxIdleConns,
+		ConnMaxLifetime:  cfg.DB.ConnMaxLifetime,
+		ConnMaxIdleTime:  cfg.DB.ConnMaxIdleTime,
+		ConnectTimeout:   cfg.DB.ConnectTimeout,
+	}
+}
+
+// newApp builds repositories and services on top of db.
+func newApp(cfg config.Config, db *gorm.DB) (*app, error) {
+	var (
+		repos    *repository.Repository
+		replicas []*gorm.DB
+	)
+	switch cfg.DB.Driver {
+	case "sqlite":
+		repos = repository.NewSQLiteRepository(db)
+	case "memory":
+		repos = repository.NewMemoryRepository()
+	default:
+		replicas = repository.NewPostgresReplicas(postgresConfig(cfg), cfg.DB.Replicas)
+		repos = repository.NewRepository(db, replicas...)
+	}
+	if err := instrumentDB(db, replicas); err != nil {
+		return nil, err
+	}
+	if cfg.DB.Driver != "postgres" {
+		logrus.Warnf("the %s driver only stores users and items, other features are unavailable", cfg.DB.Driver)
+	}
+	if cfg.Idempotency.Store == "memory" {
+		repos.Idempotency = repository.NewIdempotencyMemory()
+	}
+	if cfg.RateLimit.Store == "memory" {
+		repos.RateLimit = repository.NewRateLimitMemory()
+	}
+
+	mail, err := newMailer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := storage.NewLocalStore(cfg.Exports.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jwtSigningKey, err := signingKey(cfg.Auth.JWTSigningKey, "auth.jwt_signing_key",
+		"access tokens won't survive a restart")
+	if err != nil {
+		return nil, err
+	}
+
+	exportSigningKey, err := signingKey(cfg.Exports.SigningKey, "exports.signing_key",
+		"export download links won't survive a restart")
+	if err != nil {
+		return nil, err
+	}
+
+	runner := jobs.NewRunner(cfg.Jobs.Workers, cfg.Jobs.QueueSize)
+
+	services := service.NewService(repos, mail, store, runner, service.Config{
+		Token: service.TokenConfig{
+			SigningKey: jwtSigningKey,
+			TTL:        cfg.Auth.TokenTTL,
+		},
+		Lockout: service.LockoutConfig{
+			MaxFailures:        cfg.Auth.Lockout.MaxFailures,
+			MaxIPFailures:      cfg.Auth.Lockout.MaxIPFailures,
+			FailureWindow:      cfg.Auth.Lockout.FailureWindow,
+			LockoutDuration:    cfg.Auth.Lockout.LockoutDuration,
+			MaxLockoutDuration: cfg.Auth.Lockout.MaxLockoutDuration,
+			BaseDelay:          cfg.Auth.Lockout.BaseDelay,
+			MaxDelay:           cfg.Auth.Lockout.MaxDelay,
+		},
+		Account: service.AccountConfig{
+			PasswordResetTTL:     cfg.Auth.PasswordResetTTL,
+			EmailVerificationTTL: cfg.Auth.EmailVerificationTTL,
+			PasswordResetURL:     cfg.Mail.PasswordResetURL,
+			VerifyEmailURL:       cfg.Mail.VerifyEmailURL,
+		},
+		TwoFactor: service.TwoFactorConfig{
+			Issuer:       cfg.Auth.TOTPIssuer,
+			ChallengeTTL: cfg.Auth.TwoFactorChallengeTTL,
+		},
+		Profile: service.ProfileConfig{
+			DeletionGracePeriod: cfg.Auth.AccountDeletionGracePeriod,
+		},
+		Export: service.ExportConfig{
+			TTL:        cfg.Exports.TTL,
+			SigningKey: exportSigningKey,
+		},
+		Webhook: service.WebhookConfig{
+			MaxAttempts:          cfg.Webhooks.MaxAttempts,
+			InitialBackoff:       cfg.Webhooks.InitialBackoff,
+			MaxBackoff:           cfg.Webhooks.MaxBackoff,
+			Timeout:              cfg.Webhooks.Timeout,
+			AllowInsecure:        cfg.Webhooks.AllowInsecure,
+			AllowPrivateNetworks: cfg.Webhooks.AllowPrivateNetworks,
+		},
+		Stream: service.StreamConfig{
+			HistorySize: cfg.Stream.HistorySize,
+			BufferSize:  cfg.Stream.BufferSize,
+		},
+		Idempotency: service.IdempotencyConfig{
+			TTL:   cfg.Idempotency.TTL,
+			Lease: cfg.Idempotency.Lease,
+		},
+		RateLimit: service.RateLimitConfig{
+			Enabled: cfg.RateLimit.Enabled,
+			Rules:   rateLimitRules(cfg),
+		},
+	})
+
+	return &app{cfg: cfg, db: db, replicas: replicas, repos: repos, services: services, runner: runner}, nil
+}
+
+// withApp loads the config, opens the database and runs fn, closing
+// everything afterwards. The commands other than serve use it.
+func withApp(fn func(a *app) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	a, err := newApp(cfg, db)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	return fn(a)
+}
+
+// close stops the job runner and closes the replicas. The primary database
+// is closed by whoever opened it.
+func (a *app) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Jobs.ShutdownTimeout)
+	defer cancel()
+	if err := a.runner.Shutdown(ctx); err != nil {
+		logrus.Errorf("error occured on job runner shutting down: %s", err.Error())
+	}
+
+	for _, replica := range a.replicas {
+		closeDB(replica)
+	}
+}
+
+// instrumentDB exports query and pool metrics of the primary and replicas.
+func instrumentDB(db *gorm.DB, replicas []*gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	if err := repository.InstrumentDB(db, "primary"); err != nil {
+		return err
+	}
+	for i, replica := range replicas {
+		if err := repository.InstrumentDB(replica, fmt.Sprintf("replica_%d", i+1)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func closeDB(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+
+	if err := repository.PostgresCloseConnection(db); err != nil {
+		logrus.Errorf("error occured on db connection close: %s", err.Error())
+	}
+}
+
+// signingKey returns the configured key, or a random one with a warning
+// about what that breaks.
+func signingKey(configured, key, consequence string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+
+	logrus.Warnf("%s is not set, %s", key, consequence)
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func newMailer(cfg config.Config) (mailer.Mailer, error) {
+	return mailer.NewMailer(mailer.Config{
+		Driver: cfg.Mail.Driver,
+		From:   cfg.Mail.From,
+		SMTP: mailer.SMTPConfig{
+			Host:     cfg.Mail.SMTP.Host,
+			Port:     cfg.Mail.SMTP.Port,
+			Username: cfg.Mail.SMTP.Username,
+			Password: cfg.Mail.SMTP.Password,
+		},
+	})
+}
+
+func rateLimitRules(cfg config.Config) map[string]service.RateLimitRule {
+	rules := make(map[string]service.RateLimitRule, len(cfg.RateLimit.Groups))
+	for group, rule := range cfg.RateLimit.Groups {
+		rules[group] = service.RateLimitRule{
+			Requests: rule.Requests,
+			Period:   rule.Period,
+			Burst:    rule.Burst,
+			KeyBy:    rule.KeyBy,
+		}
+	}
+
+	return rules
+}
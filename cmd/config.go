@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const configUsage = "usage: todo_app config validate|print"
+
+// runConfig handles `todo_app config validate|print`. Loading validates, so
+// both fail with the full list of problems on a bad config; validate also
+// checks what serve requires. print shows the effective values with secrets
+// redacted.
+func runConfig(args []string) error {
+	if len(args) != 1 || (args[0] != "validate" && args[0] != "print") {
+		return errors.New(configUsage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "print" {
+		return cfg.Print(os.Stdout)
+	}
+
+	if err = cfg.ValidateServe(); err != nil {
+		return err
+	}
+
+	fmt.Println("configuration is valid")
+
+	return nil
+}
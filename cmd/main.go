@@ -1,20 +1,12 @@
 package main
 
 import (
-	"context"
-	todo "github.com/NekruzRakhimov/todo_app"
-	broker "github.com/NekruzRakhimov/todo_app/nats"
-	"github.com/NekruzRakhimov/todo_app/pkg/handler"
-	"github.com/NekruzRakhimov/todo_app/pkg/repository"
-	"github.com/NekruzRakhimov/todo_app/pkg/service"
-	"github.com/joho/godotenv"
+	"errors"
+	"flag"
+	"fmt"
 	_ "github.com/lib/pq"
-	"github.com/nats-io/nats.go"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"os"
-	"os/signal"
-	"syscall"
 )
 
 // @title Todo App API
@@ -28,66 +20,48 @@ import (
 // @in header
 // @name Authorization
 
+const usage = `usage: todo_app <command> [arguments]
+
+commands:
+  serve [--dev]                           start the HTTP server (the default)
+  migrate up|down|status|to N|force N     manage the database schema
+  user create|disable|enable|reset-password
+                                          manage accounts
+  seed --users N --items M                fill the database with sample data
+  token issue                             issue a personal access token
+  config validate|print                   check or show the effective configuration
+
+run "todo_app <command> -h" for the arguments of a command`
+
+var commands = map[string]func(args []string) error{
+	"serve":   runServe,
+	"migrate": runMigrate,
+	"user":    runUser,
+	"seed":    runSeed,
+	"token":   runToken,
+	"config":  runConfig,
+}
+
 func main() {
 	logrus.SetFormatter(new(logrus.JSONFormatter))
 
-	if err := InitConfig(); err != nil {
-		logrus.Fatalf("error initializing configs: %s", err.Error())
-	}
-
-	if err := godotenv.Load(); err != nil {
-		logrus.Fatalf("error loading env variables: %s", err.Error())
+	name, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
 	}
 
-	db, err := repository.NewPostgresDB(repository.Config{
-		Host:     viper.GetString("db.host"),
-		Port:     viper.GetString("db.port"),
-		Username: viper.GetString("db.username"),
-		Password: os.Getenv("DB_PASSWORD"),
-		DBName:   viper.GetString("db.dbname"),
-		SSLMode:  viper.GetString("db.sslmode"),
-	})
-	if err != nil {
-		logrus.Fatalf("failed to initialize db: %s", err.Error())
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Println(usage)
+		return
 	}
 
-	natsConn, err := broker.NewNatsConnection(nats.DefaultURL)
-	if err != nil {
-		logrus.Fatalf(err.Error())
-	}
-
-	repos := repository.NewRepository(db)
-	services := service.NewService(repos)
-	handlers := handler.NewHandler(services, natsConn)
-
-	srv := new(todo.Server)
-	go func() {
-		if err = srv.Run(viper.GetString("port"), handlers.InitRoutes()); err != nil {
-			logrus.Fatalf("error occured while running http server: %s", err.Error())
-		}
-	}()
-
-	logrus.Print("TodoApp Started")
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-	<-quit
-
-	logrus.Print("TodoApp Shutting Down")
-
-	if err = srv.Shutdown(context.Background()); err != nil {
-		logrus.Errorf("error occured on server shutting down: %s", err.Error())
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	if err = repository.PostgresCloseConnection(db); err != nil {
-		logrus.Errorf("error occured on db connection close: %s", err.Error())
+	if err := run(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		logrus.Fatalf("%s: %s", name, err.Error())
 	}
-
-	broker.CloseNatsConnection(natsConn)
-}
-
-func InitConfig() error {
-	viper.AddConfigPath("configs")
-	viper.SetConfigName("config")
-	return viper.ReadInConfig()
 }
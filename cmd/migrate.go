@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/pkg/migrate"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/schema"
+	"gorm.io/gorm"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = "usage: todo_app migrate up|down|status|to N|force N"
+
+func newMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(sqlDB, schema.Migrations)
+}
+
+// runMigrate handles `todo_app migrate ...`.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if cfg.DB.Driver != "postgres" {
+		return fmt.Errorf("migrations are for postgres, the %s driver creates its schema itself", cfg.DB.Driver)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer repository.PostgresCloseConnection(db)
+
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "status":
+		return printMigrateStatus(ctx, m)
+	case "to", "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		if args[0] == "force" {
+			return m.Force(ctx, uint(version))
+		}
+		return m.To(ctx, uint(version))
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrateStatus(ctx context.Context, m *migrate.Migrator) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "version: %d (latest %d)", status.Version, m.Latest())
+	if status.Dirty {
+		fmt.Fprint(os.Stdout, " dirty")
+	}
+	fmt.Fprintln(os.Stdout)
+
+	for _, migration := range m.Migrations() {
+		state := "pending"
+		if status.Applied[migration.Version] {
+			state = "applied"
+		}
+		fmt.Fprintf(os.Stdout, "%06d_%s\t%s\n", migration.Version, migration.Name, state)
+	}
+
+	return nil
+}
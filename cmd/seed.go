@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+)
+
+// runSeed handles `todo_app seed`, creating users named <prefix>_1..N with
+// M items each, for local development and load tests.
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	users := flags.Int("users", 10, "number of users")
+	items := flags.Int("items", 20, "number of items per user")
+	prefix := flags.String("prefix", "seed", "username prefix")
+	password := flags.String("password", "password", "password of every seeded user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *users < 0 || *items < 0 {
+		return errors.New("--users and --items can't be negative")
+	}
+
+	return withApp(func(a *app) error {
+		created := 0
+		for i := 1; i <= *users; i++ {
+			username := fmt.Sprintf("%s_%d", *prefix, i)
+			userID, err := a.services.Authorization.CreateUser(context.Background(), models.User{
+				Name:     fmt.Sprintf("Seed User %d", i),
+				Username: username,
+				Password: *password,
+				Email:    username + "@example.com",
+			})
+			if errors.Is(err, repository.ErrUsernameTaken) {
+				fmt.Printf("skipping %s, it already exists\n", username)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			batch := make([]models.TodoItem, 0, *items)
+			for j := 1; j <= *items; j++ {
+				batch = append(batch, models.TodoItem{
+					Title:       fmt.Sprintf("Item %d", j),
+					Description: fmt.Sprintf("Seeded item %d of %s", j, username),
+					Done:        j%3 == 0,
+				})
+			}
+			if _, err = a.services.TodoItem.BulkCreate(context.Background(), userID, batch); err != nil {
+				return err
+			}
+			created++
+		}
+
+		fmt.Printf("created %d users with %d items each\n", created, *items)
+
+		return nil
+	})
+}
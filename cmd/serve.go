@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	todo "github.com/NekruzRakhimov/todo_app"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/handler"
+	"github.com/NekruzRakhimov/todo_app/pkg/health"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runServe starts the HTTP server and blocks until SIGINT or SIGTERM.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	dev := flags.Bool("dev", false, "generate random signing keys when none are configured")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if !*dev {
+		if err = cfg.ValidateServe(); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	if cfg.DB.AutoMigrate && cfg.DB.Driver == "postgres" {
+		migrator, err := newMigrator(db)
+		if err != nil {
+			return err
+		}
+		if err = migrator.Up(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		ServiceName: cfg.Tracing.ServiceName,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	// deferred right away so spans are flushed however serve returns
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.Errorf("error occured on flushing traces: %s", err.Error())
+		}
+	}()
+
+	natsCfg := broker.Config{
+		URL:              cfg.NATS.URL,
+		Name:             cfg.NATS.Name,
+		User:             cfg.NATS.User,
+		Password:         cfg.NATS.Password,
+		Token:            cfg.NATS.Token,
+		CredsFile:        cfg.NATS.CredsFile,
+		NKeyFile:         cfg.NATS.NKeyFile,
+		TLSCertFile:      cfg.NATS.TLS.CertFile,
+		TLSKeyFile:       cfg.NATS.TLS.KeyFile,
+		TLSCAFile:        cfg.NATS.TLS.CAFile,
+		MaxReconnects:    cfg.NATS.MaxReconnects,
+		ReconnectWait:    cfg.NATS.ReconnectWait,
+		ReconnectBufSize: cfg.NATS.ReconnectBufSize,
+		DrainTimeout:     cfg.NATS.DrainTimeout,
+		Optional:         cfg.NATS.Optional,
+	}
+
+	natsConn, err := broker.NewNatsConnection(natsCfg)
+	if err != nil {
+		if !natsCfg.Optional {
+			return err
+		}
+		logrus.Warnf("nats is unavailable, continuing without broker: %s", err.Error())
+	}
+	defer broker.CloseNatsConnection(natsConn, natsCfg.DrainTimeout)
+
+	a, err := newApp(cfg, db)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	checker := health.NewChecker(cfg.HTTP.HealthCheckTimeout)
+	if db != nil {
+		checker.Add(cfg.DB.Driver, func(ctx context.Context) error {
+			return repository.PingDB(ctx, db)
+		})
+	}
+	for i, replica := range a.replicas {
+		replica := replica
+		checker.AddOptional(fmt.Sprintf("postgres_replica_%d", i+1), func(ctx context.Context) error {
+			return repository.PingDB(ctx, replica)
+		})
+	}
+	natsCheck := func(context.Context) error { return broker.CheckConnection(natsConn) }
+	if natsCfg.Optional {
+		checker.AddOptional("nats", natsCheck)
+	} else {
+		checker.Add("nats", natsCheck)
+	}
+
+	a.runner.Every("webhook retries", cfg.Webhooks.RetryInterval, a.services.Webhook.RetryDue)
+	a.runner.Every("account purge", cfg.Jobs.AccountPurgeInterval, a.services.Profile.Purge)
+	a.runner.Every("export cleanup", cfg.Exports.CleanupInterval, a.services.Export.Cleanup)
+
+	publisher := broker.NewPublisher(natsConn, natsCfg.Optional)
+	handlers := handler.NewHandler(a.services, publisher, checker, handler.Config{
+		TrustProxyHeaders: cfg.RateLimit.TrustProxyHeaders,
+		AllowedOrigins:    cfg.Stream.AllowedOrigins,
+	})
+
+	srv := todo.NewServer(cfg.Port, handlers.InitRoutes(), todo.ServerConfig{
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+	})
+	go func() {
+		if err := srv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Fatalf("error occured while running http server: %s", err.Error())
+		}
+	}()
+
+	logrus.Print("TodoApp Started")
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	<-quit
+
+	logrus.Print("TodoApp Shutting Down")
+
+	// fail readiness first and give the orchestrator time to notice before
+	// the listener closes
+	checker.ShutDown()
+	time.Sleep(cfg.HTTP.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	// the item streams never finish on their own, so they are ended first
+	if err = a.services.Stream.Close(shutdownCtx); err != nil {
+		logrus.Errorf("error occured on closing item streams: %s", err.Error())
+	}
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("error occured on server shutting down: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"strings"
+)
+
+const tokenUsage = "usage: todo_app token issue --user ID|USERNAME [--name NAME] [--scopes a,b] [--expires-in-days N]"
+
+// runToken handles `todo_app token issue`, which creates a personal access
+// token for a user, e.g. for a CI job.
+func runToken(args []string) error {
+	if len(args) == 0 || args[0] != "issue" {
+		return errors.New(tokenUsage)
+	}
+
+	flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	ref := flags.String("user", "", "id or username (required)")
+	name := flags.String("name", "cli", "token name")
+	scopes := flags.String("scopes", models.ScopeItemsRead+","+models.ScopeItemsWrite, "comma separated scopes")
+	expiresInDays := flags.Int("expires-in-days", 0, "lifetime in days, 0 never expires")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	input := models.PersonalAccessTokenInput{
+		Name:          *name,
+		ExpiresInDays: *expiresInDays,
+	}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			input.Scopes = append(input.Scopes, scope)
+		}
+	}
+
+	return withApp(func(a *app) error {
+		user, err := a.findUser(*ref)
+		if err != nil {
+			return err
+		}
+
+		token, err := a.services.AccessToken.Create(context.Background(), user.ID, input)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(token.Token)
+
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"strconv"
+	"strings"
+)
+
+const userUsage = "usage: todo_app user create|disable|enable|reset-password [arguments]"
+
+// runUser handles `todo_app user ...`. Actions are audited like the admin
+// endpoints, without an actor.
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(args[1:])
+	case "disable", "enable":
+		return runUserSetDisabled(args[0], args[1:])
+	case "reset-password":
+		return runUserResetPassword(args[1:])
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+func runUserCreate(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	username := flags.String("username", "", "username (required)")
+	name := flags.String("name", "", "display name, defaults to the username")
+	email := flags.String("email", "", "email address")
+	password := flags.String("password", "", "password, a random one is generated and printed if empty")
+	admin := flags.Bool("admin", false, "give the user the admin role")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+
+	user := models.User{
+		Name:     *name,
+		Username: strings.TrimSpace(*username),
+		Password: *password,
+		Email:    *email,
+		Role:     models.RoleUser,
+	}
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+	if *admin {
+		user.Role = models.RoleAdmin
+	}
+
+	generated := user.Password == ""
+	if generated {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		user.Password = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return withApp(func(a *app) error {
+		id, err := a.services.Authorization.CreateUser(context.Background(), user)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created user %s with id %d and role %s\n", user.Username, id, user.Role)
+		if generated {
+			fmt.Printf("password: %s\n", user.Password)
+		}
+
+		return nil
+	})
+}
+
+func runUserSetDisabled(action string, args []string) error {
+	flags := flag.NewFlagSet("user "+action, flag.ContinueOnError)
+	ref := flags.String("user", "", "id or username (required)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return withApp(func(a *app) error {
+		user, err := a.findUser(*ref)
+		if err != nil {
+			return err
+		}
+
+		if err = a.services.Admin.SetDisabled(context.Background(), 0, "", user.ID, action == "disable"); err != nil {
+			return err
+		}
+
+		fmt.Printf("user %s (id %d) %sd\n", user.Username, user.ID, action)
+
+		return nil
+	})
+}
+
+func runUserResetPassword(args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	ref := flags.String("user", "", "id or username (required)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return withApp(func(a *app) error {
+		user, err := a.findUser(*ref)
+		if err != nil {
+			return err
+		}
+
+		if err = a.services.Admin.ForcePasswordReset(context.Background(), 0, "", user.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("password of %s (id %d) reset, a reset link was sent to %s\n", user.Username, user.ID, user.Email)
+
+		return nil
+	})
+}
+
+// findUser looks a user up by id or, if ref isn't a number, by username.
+func (a *app) findUser(ref string) (models.User, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return models.User{}, errors.New("--user is required")
+	}
+
+	var user models.User
+	var err error
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		user, err = a.repos.Authorization.GetUserByID(context.Background(), id)
+	} else {
+		user, err = a.repos.Authorization.GetUserByUsername(context.Background(), ref)
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("user %q: %w", ref, err)
+	}
+
+	return user, nil
+}
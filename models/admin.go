@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AdminUser is the view of an account on the admin endpoints.
+type AdminUser struct {
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	Role             string     `json:"role"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	DisabledAt       *time.Time `json:"disabled_at"`
+	ItemCount        int        `json:"item_count"`
+	DoneItemCount    int        `json:"done_item_count"`
+}
+
+type AdminUserList struct {
+	Users []AdminUser `json:"users"`
+	Total int         `json:"total"`
+}
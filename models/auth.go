@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditAccountUnlocked = "account_unlocked"
+	AuditIPLocked        = "ip_locked"
+	AuditIPUnlocked      = "ip_unlocked"
+
+	AuditAdminUsersListed   = "admin_users_listed"
+	AuditAdminUserViewed    = "admin_user_viewed"
+	AuditAdminUserDisabled  = "admin_user_disabled"
+	AuditAdminUserEnabled   = "admin_user_enabled"
+	AuditAdminUserDeleted   = "admin_user_deleted"
+	AuditAdminPasswordReset = "admin_password_reset"
+)
+
+// LoginAttempt counts failed logins for a username or an IP.
+type LoginAttempt struct {
+	Key         string
+	Failures    int
+	Lockouts    int
+	LockedUntil *time.Time
+}
+
+type AuthAuditEntry struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id"`
+	ActorID   *int      `json:"actor_id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Event     string    `json:"event"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// EventStreamResync is sent first to a resuming client whose Last-Event-ID
+// can't be resumed, e.g. after a restart. Events may have been missed, so the
+// client should catch up with /api/sync before applying the following ones.
+const EventStreamResync = "stream.resync"
+
+// ItemEvent is a change to one of the user's items, pushed to live streams.
+type ItemEvent struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// StreamToken opens the item streams for clients that can't set the
+// Authorization header, such as browser EventSource and WebSocket.
+type StreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request made with an Idempotency-Key.
+type IdempotencyRecord struct {
+	UserID       int
+	Key          string
+	RequestHash  string
+	Completed    bool
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	ExpiresAt    time.Time
+	// LockToken identifies the request holding an uncompleted record, until
+	// LockedUntil.
+	LockToken   string
+	LockedUntil time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	ScopeItemsRead     = "items:read"
+	ScopeItemsWrite    = "items:write"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	// ScopeAccount covers account security settings: 2FA and personal access tokens.
+	ScopeAccount = "account"
+	ScopeAdmin   = "admin"
+)
+
+// RoleScopes are the scopes put in the access tokens of each role.
+var RoleScopes = map[string][]string{
+	RoleUser: {ScopeItemsRead, ScopeItemsWrite, ScopeWebhooksRead, ScopeWebhooksWrite, ScopeAccount},
+	RoleAdmin: {ScopeItemsRead, ScopeItemsWrite, ScopeWebhooksRead, ScopeWebhooksWrite, ScopeAccount,
+		ScopeAdmin},
+}
+
+// Identity is who a request is authenticated as and what it may do.
+type Identity struct {
+	UserID int
+	Scopes []string
+}
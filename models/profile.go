@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Profile is the signed-in user's own view of their account. DeleteAfter is
+// set while the account is scheduled for deletion.
+type Profile struct {
+	ID               int             `json:"id"`
+	Name             string          `json:"name"`
+	Username         string          `json:"username"`
+	Email            string          `json:"email"`
+	EmailVerified    bool            `json:"email_verified"`
+	Timezone         string          `json:"timezone"`
+	Locale           string          `json:"locale"`
+	Preferences      json.RawMessage `json:"preferences" swaggertype:"object"`
+	TwoFactorEnabled bool            `json:"two_factor_enabled"`
+	DeleteAfter      *time.Time      `json:"delete_after"`
+}
+
+// ProfileUpdateInput changes only the fields that are set.
+type ProfileUpdateInput struct {
+	Name        *string          `json:"name"`
+	Timezone    *string          `json:"timezone"`
+	Locale      *string          `json:"locale"`
+	Preferences *json.RawMessage `json:"preferences" swaggertype:"object"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+const (
+	AuditPasswordChanged          = "password_changed"
+	AuditAccountDeletionScheduled = "account_deletion_scheduled"
+	AuditAccountDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountsPurged           = "accounts_purged"
+)
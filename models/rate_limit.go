@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the number of requests allowed per period; a burst allowance
+	// may let more through at once.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed.
+	RetryAfter time.Duration
+}
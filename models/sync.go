@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+const (
+	SyncOpCreate = "create"
+	SyncOpUpdate = "update"
+	SyncOpDelete = "delete"
+)
+
+const (
+	SyncLastWriterWins = "last_writer_wins"
+	SyncVersionCheck   = "version"
+)
+
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncRejected = "rejected"
+)
+
+// SyncItem is an item as seen by the sync protocol, including soft-deleted ones.
+type SyncItem struct {
+	ID          int       `json:"id"`
+	ClientID    string    `json:"client_id,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Done        bool      `json:"done"`
+	IsRemoved   bool      `json:"-"`
+	Version     int       `json:"version"`
+	Revision    int64     `json:"-"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Tombstone struct {
+	ID        int       `json:"id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Version   int       `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type SyncChanges struct {
+	Items      []SyncItem  `json:"items"`
+	Tombstones []Tombstone `json:"tombstones"`
+	NextToken  string      `json:"next_token"`
+	HasMore    bool        `json:"has_more"`
+}
+
+type SyncMutation struct {
+	Op          string `json:"op"`
+	ID          int    `json:"id"`
+	ClientID    string `json:"client_id"`
+	BaseVersion int    `json:"base_version"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Done        bool   `json:"done"`
+	// UpdatedAt is when the client made the change, used by last-writer-wins.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SyncBatch struct {
+	Strategy  string         `json:"strategy"`
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+type SyncResult struct {
+	ClientID string    `json:"client_id,omitempty"`
+	ID       int       `json:"id,omitempty"`
+	Status   string    `json:"status"`
+	Item     *SyncItem `json:"item,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Changed is false for a mutation applied before, e.g. a retried create,
+	// so the server doesn't announce it again.
+	Changed bool `json:"-"`
+}
@@ -11,6 +11,7 @@ type TodoItem struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	Done        bool   `json:"done"`
+	ClientID    string `json:"client_id,omitempty"`
 	UserID      int    `json:"-"`
 }
 
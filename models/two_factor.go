@@ -0,0 +1,36 @@
+package models
+
+// TwoFactor is a user's TOTP state. LastStep is the last time step a code
+// was accepted for, so the same code can't be used twice.
+type TwoFactor struct {
+	UserID   int    `gorm:"user_id"`
+	Secret   string `gorm:"totp_secret"`
+	Enabled  bool   `gorm:"totp_enabled"`
+	LastStep int64  `gorm:"totp_last_step"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorSignInInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// SignInResult holds either the access token or, for accounts with 2FA
+// enabled, the challenge token to exchange for it at /auth/sign-in/2fa.
+type SignInResult struct {
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
@@ -5,9 +5,30 @@ type User struct {
 	Name     string `json:"name" gorm:"name" binding:"required"`
 	Username string `json:"username" gorm:"username" binding:"required"`
 	Password string `json:"password" gorm:"password_hash" binding:"required"`
+	Email    string `json:"email" gorm:"email"`
+	Role     string `json:"-" gorm:"role"`
+	Disabled bool   `json:"-" gorm:"disabled"`
 }
 
 type SignInInput struct {
 	Username string `json:"username" gorm:"username" binding:"required"`
 	Password string `json:"password" gorm:"password" binding:"required"`
 }
+
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
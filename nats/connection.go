@@ -1,20 +1,148 @@
 package broker
 
 import (
+	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go"
-	"log"
+	"github.com/sirupsen/logrus"
+	"time"
 )
 
-func NewNatsConnection(url string) (*nats.Conn, error) {
-	nc, err := nats.Connect(url)
+type Config struct {
+	URL              string
+	Name             string
+	User             string
+	Password         string
+	Token            string
+	CredsFile        string
+	NKeyFile         string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSCAFile        string
+	MaxReconnects    int
+	ReconnectWait    time.Duration
+	ReconnectBufSize int
+	DrainTimeout     time.Duration
+	// Optional lets the API start and keep serving while NATS is unreachable.
+	Optional bool
+}
+
+func NewNatsConnection(cfg Config) (*nats.Conn, error) {
+	opts, err := connectionOptions(cfg)
+	if err != nil {
+		logrus.Errorf("invalid nats configuration: %s", err.Error())
+		return nil, err
+	}
+
+	nc, err := nats.Connect(cfg.URL, opts...)
 	if err != nil {
-		log.Println("Couldn't connect to nats: ", err.Error())
+		logrus.Errorf("couldn't connect to nats: %s", err.Error())
 		return nil, err
 	}
 
 	return nc, nil
 }
 
-func CloseNatsConnection(conn *nats.Conn) {
-	conn.Close()
+// CloseNatsConnection drains the connection so in-flight messages are flushed
+// before it is closed. It waits no longer than timeout.
+func CloseNatsConnection(conn *nats.Conn, timeout time.Duration) {
+	if conn == nil || conn.IsClosed() {
+		return
+	}
+
+	if err := conn.Drain(); err != nil {
+		logrus.Warnf("couldn't drain nats connection, closing: %s", err.Error())
+		conn.Close()
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for !conn.IsClosed() {
+		if time.Now().After(deadline) {
+			logrus.Warn("nats drain timed out, closing")
+			conn.Close()
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func connectionOptions(cfg Config) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name(cfg.Name),
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.ReconnectWait(cfg.ReconnectWait),
+		nats.DrainTimeout(cfg.DrainTimeout),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			logrus.Infof("nats connected to %s", nc.ConnectedUrlRedacted())
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logrus.Warnf("nats disconnected: %s", err.Error())
+				return
+			}
+			logrus.Info("nats disconnected")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logrus.Infof("nats reconnected to %s", nc.ConnectedUrlRedacted())
+		}),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			logrus.Info("nats connection closed")
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+			if sub != nil {
+				logrus.Errorf("nats error on subject %s: %s", sub.Subject, err.Error())
+				return
+			}
+			logrus.Errorf("nats error: %s", err.Error())
+		}),
+	}
+
+	if cfg.ReconnectBufSize != 0 {
+		opts = append(opts, nats.ReconnectBufSize(cfg.ReconnectBufSize))
+	}
+
+	if cfg.Optional {
+		opts = append(opts, nats.RetryOnFailedConnect(true))
+	}
+
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	case cfg.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.User != "":
+		opts = append(opts, nats.UserInfo(cfg.User, cfg.Password))
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, errors.New("both nats tls cert and key files must be set")
+		}
+		opts = append(opts, nats.ClientCert(cfg.TLSCertFile, cfg.TLSKeyFile))
+	}
+
+	if cfg.TLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLSCAFile))
+	}
+
+	return opts, nil
+}
+
+// CheckConnection reports an error unless conn is connected to the server.
+func CheckConnection(conn *nats.Conn) error {
+	if conn == nil {
+		return ErrNotConnected
+	}
+	if status := conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("nats connection is %s", status)
+	}
+
+	return nil
 }
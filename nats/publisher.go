@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/pkg/metrics"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrNotConnected = errors.New("nats connection is not established")
+
+// Publisher sends events to NATS. When the broker is optional, publish
+// failures are logged and swallowed so requests don't fail because of it.
+type Publisher struct {
+	conn     *nats.Conn
+	optional bool
+}
+
+func NewPublisher(conn *nats.Conn, optional bool) *Publisher {
+	return &Publisher{conn: conn, optional: optional}
+}
+
+// Publish sends data to subject in a span of its own, with the trace context
+// in the message headers so consumers continue the trace.
+func (p *Publisher) Publish(ctx context.Context, subject string, data []byte) error {
+	ctx, span := tracing.Start(ctx, subject+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("nats"),
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	tracing.Inject(ctx, headerCarrier(msg.Header))
+
+	err := ErrNotConnected
+	if p.conn != nil {
+		err = p.conn.PublishMsg(msg)
+	}
+	tracing.End(span, err)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.NATSPublished.WithLabelValues(subject, result).Inc()
+
+	if err != nil && p.optional {
+		logrus.Warnf("couldn't publish to %s: %s", subject, err.Error())
+		return nil
+	}
+
+	return err
+}
+
+func (p *Publisher) Conn() *nats.Conn {
+	return p.conn
+}
+
+// headerCarrier lets the propagator use NATS headers, which unlike HTTP ones
+// are case-sensitive, so the W3C keys are kept as written ("traceparent").
+type headerCarrier nats.Header
+
+func (h headerCarrier) Get(key string) string {
+	return nats.Header(h).Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	nats.Header(h).Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
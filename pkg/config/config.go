@@ -0,0 +1,381 @@
+// Package config loads the application configuration from configs/config.yml,
+// an optional .env file and TODO_* environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables that override the file, e.g.
+// TODO_DB_HOST for db.host.
+const EnvPrefix = "TODO"
+
+type Config struct {
+	Port        string      `mapstructure:"port"`
+	HTTP        HTTP        `mapstructure:"http"`
+	DB          DB          `mapstructure:"db"`
+	NATS        NATS        `mapstructure:"nats"`
+	Webhooks    Webhooks    `mapstructure:"webhooks"`
+	Stream      Stream      `mapstructure:"stream"`
+	Idempotency Idempotency `mapstructure:"idempotency"`
+	RateLimit   RateLimit   `mapstructure:"rate_limit"`
+	Auth        Auth        `mapstructure:"auth"`
+	Mail        Mail        `mapstructure:"mail"`
+	Jobs        Jobs        `mapstructure:"jobs"`
+	Exports     Exports     `mapstructure:"exports"`
+	Tracing     Tracing     `mapstructure:"tracing"`
+}
+
+type HTTP struct {
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// ShutdownDelay is how long /readyz fails before the server stops
+	// accepting connections.
+	ShutdownDelay      time.Duration `mapstructure:"shutdown_delay"`
+	HealthCheckTimeout time.Duration `mapstructure:"health_check_timeout"`
+}
+
+type DB struct {
+	// Driver is postgres, sqlite or memory. Only postgres supports every feature.
+	Driver     string `mapstructure:"driver"`
+	SQLitePath string `mapstructure:"sqlite_path"`
+	// URL is a postgres:// URL or key=value DSN used instead of host, port,
+	// username, password, dbname and sslmode.
+	URL         string `mapstructure:"url" secret:"true"`
+	Host        string `mapstructure:"host"`
+	Port        string `mapstructure:"port"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password" secret:"true"`
+	DBName      string `mapstructure:"dbname"`
+	SSLMode     string `mapstructure:"sslmode"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"`
+	// StatementTimeout is applied by Postgres to every statement.
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+	// ConnectTimeout is how long startup keeps retrying the first connection.
+	ConnectTimeout  time.Duration `mapstructure:"connect_timeout"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// Replicas are URLs or DSNs of read replicas serving item lists and
+	// lookups.
+	Replicas []string `mapstructure:"replicas" secret:"true"`
+}
+
+type NATS struct {
+	URL              string        `mapstructure:"url"`
+	Name             string        `mapstructure:"name"`
+	User             string        `mapstructure:"user"`
+	Password         string        `mapstructure:"password" secret:"true"`
+	Token            string        `mapstructure:"token" secret:"true"`
+	CredsFile        string        `mapstructure:"creds_file"`
+	NKeyFile         string        `mapstructure:"nkey_file"`
+	TLS              NATSTLS       `mapstructure:"tls"`
+	MaxReconnects    int           `mapstructure:"max_reconnects"`
+	ReconnectWait    time.Duration `mapstructure:"reconnect_wait"`
+	ReconnectBufSize int           `mapstructure:"reconnect_buf_size"`
+	DrainTimeout     time.Duration `mapstructure:"drain_timeout"`
+	Optional         bool          `mapstructure:"optional"`
+}
+
+type NATSTLS struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	CAFile   string `mapstructure:"ca_file"`
+}
+
+type Webhooks struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	AllowInsecure  bool          `mapstructure:"allow_insecure"`
+	// AllowPrivateNetworks lets webhooks call loopback, link-local and
+	// private addresses, for local development only.
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+	// RetryInterval is how often pending deliveries are checked for a due retry.
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+}
+
+type Stream struct {
+	HistorySize int `mapstructure:"history_size"`
+	BufferSize  int `mapstructure:"buffer_size"`
+	// AllowedOrigins may open the WebSocket stream from a browser besides
+	// pages served from the API's own host.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+type Idempotency struct {
+	Store string        `mapstructure:"store"`
+	TTL   time.Duration `mapstructure:"ttl"`
+	// Lease is how long a request holds its key before a retry of the same
+	// request may take it over. Keep it above the slowest request.
+	Lease time.Duration `mapstructure:"lease"`
+}
+
+type RateLimit struct {
+	Enabled           bool                      `mapstructure:"enabled"`
+	Store             string                    `mapstructure:"store"`
+	TrustProxyHeaders bool                      `mapstructure:"trust_proxy_headers"`
+	Groups            map[string]RateLimitGroup `mapstructure:"groups"`
+}
+
+type RateLimitGroup struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+	KeyBy    string        `mapstructure:"key_by"`
+}
+
+type Auth struct {
+	// JWTSigningKey signs access tokens. serve requires it unless started
+	// with --dev; the other commands use a random key without it.
+	JWTSigningKey              string        `mapstructure:"jwt_signing_key" secret:"true"`
+	TokenTTL                   time.Duration `mapstructure:"token_ttl"`
+	PasswordResetTTL           time.Duration `mapstructure:"password_reset_ttl"`
+	EmailVerificationTTL       time.Duration `mapstructure:"email_verification_ttl"`
+	TOTPIssuer                 string        `mapstructure:"totp_issuer"`
+	TwoFactorChallengeTTL      time.Duration `mapstructure:"two_factor_challenge_ttl"`
+	AccountDeletionGracePeriod time.Duration `mapstructure:"account_deletion_grace_period"`
+	Lockout                    Lockout       `mapstructure:"lockout"`
+}
+
+type Lockout struct {
+	MaxFailures        int           `mapstructure:"max_failures"`
+	MaxIPFailures      int           `mapstructure:"max_ip_failures"`
+	FailureWindow      time.Duration `mapstructure:"failure_window"`
+	LockoutDuration    time.Duration `mapstructure:"lockout_duration"`
+	MaxLockoutDuration time.Duration `mapstructure:"max_lockout_duration"`
+	BaseDelay          time.Duration `mapstructure:"base_delay"`
+	MaxDelay           time.Duration `mapstructure:"max_delay"`
+}
+
+type Mail struct {
+	Driver           string `mapstructure:"driver"`
+	From             string `mapstructure:"from"`
+	PasswordResetURL string `mapstructure:"password_reset_url"`
+	VerifyEmailURL   string `mapstructure:"verify_email_url"`
+	SMTP             SMTP   `mapstructure:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+}
+
+type Jobs struct {
+	Workers         int           `mapstructure:"workers"`
+	QueueSize       int           `mapstructure:"queue_size"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// AccountPurgeInterval is how often accounts past their deletion grace
+	// period are deleted.
+	AccountPurgeInterval time.Duration `mapstructure:"account_purge_interval"`
+}
+
+type Exports struct {
+	Dir string        `mapstructure:"dir"`
+	TTL time.Duration `mapstructure:"ttl"`
+	// CleanupInterval is how often expired archives are deleted.
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+	// SigningKey signs download links. Required like auth.jwt_signing_key.
+	SigningKey string `mapstructure:"signing_key" secret:"true"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout or otlp.
+	Exporter    string `mapstructure:"exporter"`
+	ServiceName string `mapstructure:"service_name"`
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// legacyEnv are the variables secrets were read from before TODO_* existed.
+// They still work, the TODO_* names win.
+var legacyEnv = map[string]string{
+	"db.password":         "DB_PASSWORD",
+	"nats.password":       "NATS_PASSWORD",
+	"nats.token":          "NATS_TOKEN",
+	"mail.smtp.password":  "SMTP_PASSWORD",
+	"exports.signing_key": "EXPORT_SIGNING_KEY",
+}
+
+// Load reads the config file at path, or configs/config.yml if path is
+// empty, applies .env and the environment on top of it and validates the
+// result. A missing .env or config file isn't an error; the defaults are
+// used instead.
+func Load(path string) (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("loading .env: %w", err)
+	}
+
+	v := viper.New()
+	setDefaults(v)
+
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, legacy := range legacyEnv {
+		envKey := EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if err := v.BindEnv(key, envKey, legacy); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.AddConfigPath("configs")
+		v.SetConfigName("config")
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return Config{}, fmt.Errorf("decoding config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func setDefaults(v *viper.Viper) {
+	defaults := map[string]interface{}{
+		"port": "8880",
+
+		"http.read_timeout":         "10s",
+		"http.write_timeout":        "10s",
+		"http.shutdown_timeout":     "30s",
+		"http.shutdown_delay":       "5s",
+		"http.health_check_timeout": "2s",
+
+		"db.driver":             "postgres",
+		"db.sqlite_path":        "./data/todo.db",
+		"db.host":               "localhost",
+		"db.port":               "5432",
+		"db.username":           "postgres",
+		"db.password":           "",
+		"db.dbname":             "todo_db",
+		"db.sslmode":            "disable",
+		"db.auto_migrate":       false,
+		"db.statement_timeout":  "5s",
+		"db.url":                "",
+		"db.connect_timeout":    "30s",
+		"db.max_open_conns":     25,
+		"db.max_idle_conns":     5,
+		"db.conn_max_lifetime":  "30m",
+		"db.conn_max_idle_time": "5m",
+		"db.replicas":           []string{},
+
+		"nats.url":                "nats://localhost:4222",
+		"nats.name":               "todo_app",
+		"nats.user":               "",
+		"nats.password":           "",
+		"nats.token":              "",
+		"nats.creds_file":         "",
+		"nats.nkey_file":          "",
+		"nats.tls.cert_file":      "",
+		"nats.tls.key_file":       "",
+		"nats.tls.ca_file":        "",
+		"nats.max_reconnects":     -1,
+		"nats.reconnect_wait":     "2s",
+		"nats.reconnect_buf_size": 8 * 1024 * 1024,
+		"nats.drain_timeout":      "10s",
+		"nats.optional":           true,
+
+		"webhooks.max_attempts":           6,
+		"webhooks.initial_backoff":        "5s",
+		"webhooks.max_backoff":            "10m",
+		"webhooks.timeout":                "10s",
+		"webhooks.allow_insecure":         false,
+		"webhooks.allow_private_networks": false,
+		"webhooks.retry_interval":         "5s",
+
+		"stream.history_size":    100,
+		"stream.buffer_size":     32,
+		"stream.allowed_origins": []string{},
+
+		"idempotency.store": "postgres",
+		"idempotency.ttl":   "24h",
+		"idempotency.lease": "1m",
+
+		"rate_limit.enabled":             true,
+		"rate_limit.store":               "memory",
+		"rate_limit.trust_proxy_headers": false,
+
+		"auth.jwt_signing_key":               "",
+		"auth.token_ttl":                     "12h",
+		"auth.password_reset_ttl":            "1h",
+		"auth.email_verification_ttl":        "48h",
+		"auth.totp_issuer":                   "TodoApp",
+		"auth.two_factor_challenge_ttl":      "5m",
+		"auth.account_deletion_grace_period": "720h",
+		"auth.lockout.max_failures":          5,
+		"auth.lockout.max_ip_failures":       50,
+		"auth.lockout.failure_window":        "15m",
+		"auth.lockout.lockout_duration":      "15m",
+		"auth.lockout.max_lockout_duration":  "24h",
+		"auth.lockout.base_delay":            "250ms",
+		"auth.lockout.max_delay":             "4s",
+
+		"mail.driver":             "log",
+		"mail.from":               "Todo App <no-reply@todo.local>",
+		"mail.password_reset_url": "http://localhost:8880/reset-password?token=",
+		"mail.verify_email_url":   "http://localhost:8880/auth/verify-email?token=",
+		"mail.smtp.host":          "localhost",
+		"mail.smtp.port":          "25",
+		"mail.smtp.username":      "",
+		"mail.smtp.password":      "",
+
+		"jobs.workers":                2,
+		"jobs.queue_size":             100,
+		"jobs.shutdown_timeout":       "30s",
+		"jobs.account_purge_interval": "1h",
+
+		"exports.dir":              "./data/exports",
+		"exports.ttl":              "72h",
+		"exports.cleanup_interval": "1h",
+		"exports.signing_key":      "",
+
+		"tracing.exporter":     "none",
+		"tracing.service_name": "todo_app",
+		"tracing.endpoint":     "localhost:4318",
+		"tracing.insecure":     true,
+		"tracing.sample_ratio": 1.0,
+	}
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	groups := map[string]RateLimitGroup{
+		"auth": {Requests: 10, Period: time.Minute, Burst: 5, KeyBy: "ip"},
+		"api":  {Requests: 600, Period: time.Minute, Burst: 100, KeyBy: "user"},
+		"bulk": {Requests: 20, Period: time.Minute, Burst: 5, KeyBy: "user"},
+	}
+	for name, group := range groups {
+		prefix := "rate_limit.groups." + name + "."
+		v.SetDefault(prefix+"requests", group.Requests)
+		v.SetDefault(prefix+"period", group.Period.String())
+		v.SetDefault(prefix+"burst", group.Burst)
+		v.SetDefault(prefix+"key_by", group.KeyBy)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+const redacted = "[redacted]"
+
+// Print writes the effective config as `key: value` lines, using the keys of
+// the config file. Fields tagged secret are redacted.
+func (c Config) Print(w io.Writer) error {
+	return printValue(w, "", reflect.ValueOf(c))
+}
+
+func printValue(w io.Writer, prefix string, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			key := field.Tag.Get("mapstructure")
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if field.Tag.Get("secret") == "true" {
+				if err := printLine(w, key, redact(value.Field(i))); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := printValue(w, key, value.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		keys := make([]string, 0, value.Len())
+		for _, k := range value.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := printValue(w, prefix+"."+k, value.MapIndex(reflect.ValueOf(k))); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return printLine(w, prefix, value.Interface())
+	}
+}
+
+func printLine(w io.Writer, key string, value interface{}) error {
+	_, err := fmt.Fprintf(w, "%s: %v\n", key, value)
+	return err
+}
+
+func redact(secret reflect.Value) string {
+	if secret.IsZero() || (secret.Kind() == reflect.Slice && secret.Len() == 0) {
+		return ""
+	}
+
+	return redacted
+}
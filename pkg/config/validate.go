@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSigningKeyLength is the shortest signing key accepted, in bytes.
+const minSigningKeyLength = 32
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+// Validate reports every problem with the config at once, one per line, with
+// the keys named as in the config file.
+func (c Config) Validate() error {
+	var v validator
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		v.addf("port must be a number between 1 and 65535, got %q", c.Port)
+	}
+	v.positive("http.read_timeout", c.HTTP.ReadTimeout)
+	v.positive("http.write_timeout", c.HTTP.WriteTimeout)
+	v.positive("http.shutdown_timeout", c.HTTP.ShutdownTimeout)
+	if c.HTTP.ShutdownDelay < 0 {
+		v.addf("http.shutdown_delay must not be negative, got %s", c.HTTP.ShutdownDelay)
+	}
+	v.positive("http.health_check_timeout", c.HTTP.HealthCheckTimeout)
+
+	v.oneOf("db.driver", c.DB.Driver, "postgres", "sqlite", "memory")
+	switch c.DB.Driver {
+	case "postgres":
+		if c.DB.URL == "" {
+			v.required("db.host", c.DB.Host)
+			v.required("db.port", c.DB.Port)
+			v.required("db.username", c.DB.Username)
+			v.required("db.dbname", c.DB.DBName)
+			if !sslModes[c.DB.SSLMode] {
+				v.addf("db.sslmode %q is not a postgres sslmode", c.DB.SSLMode)
+			}
+		}
+		v.positive("db.statement_timeout", c.DB.StatementTimeout)
+		v.positive("db.connect_timeout", c.DB.ConnectTimeout)
+		v.positiveInt("db.max_open_conns", c.DB.MaxOpenConns)
+		v.positiveInt("db.max_idle_conns", c.DB.MaxIdleConns)
+		if c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+			v.addf("db.max_idle_conns must not exceed db.max_open_conns")
+		}
+		v.positive("db.conn_max_lifetime", c.DB.ConnMaxLifetime)
+		v.positive("db.conn_max_idle_time", c.DB.ConnMaxIdleTime)
+		for i, replica := range c.DB.Replicas {
+			v.required(fmt.Sprintf("db.replicas[%d]", i), replica)
+		}
+	case "sqlite":
+		v.required("db.sqlite_path", c.DB.SQLitePath)
+	}
+
+	v.required("nats.url", c.NATS.URL)
+	v.positive("nats.reconnect_wait", c.NATS.ReconnectWait)
+	v.positive("nats.drain_timeout", c.NATS.DrainTimeout)
+
+	v.positiveInt("webhooks.max_attempts", c.Webhooks.MaxAttempts)
+	v.positive("webhooks.initial_backoff", c.Webhooks.InitialBackoff)
+	v.positive("webhooks.max_backoff", c.Webhooks.MaxBackoff)
+	v.positive("webhooks.timeout", c.Webhooks.Timeout)
+	v.positive("webhooks.retry_interval", c.Webhooks.RetryInterval)
+
+	v.positiveInt("stream.history_size", c.Stream.HistorySize)
+	v.positiveInt("stream.buffer_size", c.Stream.BufferSize)
+
+	v.oneOf("idempotency.store", c.Idempotency.Store, "postgres", "memory")
+	v.positive("idempotency.ttl", c.Idempotency.TTL)
+	v.positive("idempotency.lease", c.Idempotency.Lease)
+
+	v.oneOf("rate_limit.store", c.RateLimit.Store, "memory", "postgres")
+	groups := make([]string, 0, len(c.RateLimit.Groups))
+	for name := range c.RateLimit.Groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, name := range groups {
+		group, prefix := c.RateLimit.Groups[name], "rate_limit.groups."+name+"."
+		v.positiveInt(prefix+"requests", group.Requests)
+		v.positive(prefix+"period", group.Period)
+		if group.Burst < 0 {
+			v.addf("%sburst can't be negative", prefix)
+		}
+		v.oneOf(prefix+"key_by", group.KeyBy, "ip", "user")
+	}
+
+	v.signingKey("auth.jwt_signing_key", c.Auth.JWTSigningKey)
+	v.positive("auth.token_ttl", c.Auth.TokenTTL)
+	v.positive("auth.password_reset_ttl", c.Auth.PasswordResetTTL)
+	v.positive("auth.email_verification_ttl", c.Auth.EmailVerificationTTL)
+	v.required("auth.totp_issuer", c.Auth.TOTPIssuer)
+	v.positive("auth.two_factor_challenge_ttl", c.Auth.TwoFactorChallengeTTL)
+	v.positive("auth.account_deletion_grace_period", c.Auth.AccountDeletionGracePeriod)
+	v.positiveInt("auth.lockout.max_failures", c.Auth.Lockout.MaxFailures)
+	v.positiveInt("auth.lockout.max_ip_failures", c.Auth.Lockout.MaxIPFailures)
+	v.positive("auth.lockout.failure_window", c.Auth.Lockout.FailureWindow)
+	v.positive("auth.lockout.lockout_duration", c.Auth.Lockout.LockoutDuration)
+	v.positive("auth.lockout.max_lockout_duration", c.Auth.Lockout.MaxLockoutDuration)
+	v.positive("auth.lockout.base_delay", c.Auth.Lockout.BaseDelay)
+	v.positive("auth.lockout.max_delay", c.Auth.Lockout.MaxDelay)
+	if c.Auth.Lockout.MaxLockoutDuration < c.Auth.Lockout.LockoutDuration {
+		v.addf("auth.lockout.max_lockout_duration can't be shorter than auth.lockout.lockout_duration")
+	}
+
+	v.oneOf("mail.driver", c.Mail.Driver, "smtp", "log", "memory")
+	v.required("mail.from", c.Mail.From)
+	if c.Mail.Driver == "smtp" {
+		v.required("mail.smtp.host", c.Mail.SMTP.Host)
+		v.required("mail.smtp.port", c.Mail.SMTP.Port)
+	}
+
+	v.positiveInt("jobs.workers", c.Jobs.Workers)
+	v.positiveInt("jobs.queue_size", c.Jobs.QueueSize)
+	v.positive("jobs.shutdown_timeout", c.Jobs.ShutdownTimeout)
+	v.positive("jobs.account_purge_interval", c.Jobs.AccountPurgeInterval)
+
+	v.required("exports.dir", c.Exports.Dir)
+	v.positive("exports.ttl", c.Exports.TTL)
+	v.positive("exports.cleanup_interval", c.Exports.CleanupInterval)
+	v.signingKey("exports.signing_key", c.Exports.SigningKey)
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	if c.Tracing.Exporter != "none" {
+		v.required("tracing.service_name", c.Tracing.ServiceName)
+	}
+	if c.Tracing.Exporter == "otlp" {
+		v.required("tracing.endpoint", c.Tracing.Endpoint)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.addf("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	return v.err()
+}
+
+// ValidateServe adds the checks for running the server: the signing keys
+// must be configured, a random one would log everyone out on restart and
+// differ between instances.
+func (c Config) ValidateServe() error {
+	var v validator
+	v.required("auth.jwt_signing_key", c.Auth.JWTSigningKey)
+	v.required("exports.signing_key", c.Exports.SigningKey)
+
+	return v.err()
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return errors.New("invalid configuration:\n  " + strings.Join(v.problems, "\n  "))
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", key)
+	}
+}
+
+func (v *validator) positive(key string, value time.Duration) {
+	if value <= 0 {
+		v.addf("%s must be a positive duration, got %s", key, value)
+	}
+}
+
+func (v *validator) positiveInt(key string, value int) {
+	if value <= 0 {
+		v.addf("%s must be positive, got %d", key, value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.addf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+}
+
+// signingKey accepts an empty key, which means a random one, but not a short one.
+func (v *validator) signingKey(key, value string) {
+	if value != "" && len(value) < minSigningKeyLength {
+		v.addf("%s must be at least %d bytes long", key, minSigningKeyLength)
+	}
+}
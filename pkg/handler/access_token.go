@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+const accessTokenPath = "^/api/tokens/([0-9]+)$"
+
+var accessTokenRe = regexp.MustCompile(accessTokenPath)
+
+type AccessToken struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewAccessToken(services *service.Service, nats *broker.Publisher) *AccessToken {
+	return &AccessToken{services: services, nats: nats}
+}
+
+func (t *AccessToken) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/api/tokens" || path == "/api/tokens/":
+		switch r.Method {
+		case http.MethodGet:
+			t.getAllTokens(w, r)
+		case http.MethodPost:
+			t.createToken(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case accessTokenRe.MatchString(path):
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		t.revokeToken(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// @Summary Create personal access token
+// @Security ApiKeyAuth
+// @Tags tokens
+// @Description create a long-lived scoped token for scripts and CI; the token is returned only once
+// @ID create-access-token
+// @Accept  json
+// @Produce  json
+// @Param input body models.PersonalAccessTokenInput true "token name, scopes and optional lifetime"
+// @Success 201 {object} models.PersonalAccessToken
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/tokens [post]
+func (t *AccessToken) createToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.PersonalAccessTokenInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := t.services.AccessToken.Create(r.Context(), userID, input)
+	if err != nil {
+		newAccessTokenErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusCreated, token)
+}
+
+// @Summary Get all personal access tokens
+// @Security ApiKeyAuth
+// @Tags tokens
+// @Description list personal access tokens with their last-used time, including revoked ones
+// @ID get-all-access-tokens
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.PersonalAccessToken
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/tokens [get]
+func (t *AccessToken) getAllTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := t.services.AccessToken.GetAll(r.Context(), userID)
+	if err != nil {
+		newAccessTokenErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, tokens)
+}
+
+// @Summary Revoke personal access token
+// @Security ApiKeyAuth
+// @Tags tokens
+// @Description revoke a personal access token; it stops working immediately
+// @ID revoke-access-token
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "token id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/tokens/{id} [delete]
+func (t *AccessToken) revokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokenID, err := getPathParam(accessTokenPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = t.services.AccessToken.Revoke(r.Context(), userID, tokenID); err != nil {
+		newAccessTokenErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+func newAccessTokenErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTokenName), errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidTokenLifetime):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		newErrResponse(w, http.StatusNotFound, "token not found")
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
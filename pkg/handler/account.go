@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"io"
+	"net/http"
+)
+
+// @Summary Forgot password
+// @Tags auth
+// @Description email a password reset link; responds the same whether or not the email is registered
+// @ID forgot-password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ForgotPasswordInput true "account email"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /auth/password/forgot [post]
+func (a *Auth) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.ForgotPasswordInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Email == "" {
+		newErrResponse(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	if err = a.services.Account.ForgotPassword(r.Context(), input.Email); err != nil {
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Reset password
+// @Tags auth
+// @Description set a new password using the token from the reset email
+// @ID reset-password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ResetPasswordInput true "reset token and new password"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /auth/password/reset [post]
+func (a *Auth) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.ResetPasswordInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = a.services.Account.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		newAccountErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Verify email
+// @Tags auth
+// @Description confirm the account email with the token from the verification email
+// @ID verify-email
+// @Accept  json
+// @Produce  json
+// @Param token query string false "verification token"
+// @Param input body models.VerifyEmailInput false "verification token"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /auth/verify-email [post]
+func (a *Auth) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input models.VerifyEmailInput
+	switch r.Method {
+	case http.MethodGet:
+		// links in emails are opened with GET
+		input.Token = r.URL.Query().Get("token")
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			newErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err = json.Unmarshal(body, &input); err != nil {
+			newErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := a.services.Account.VerifyEmail(r.Context(), input.Token); err != nil {
+		newAccountErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+func newAccountErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrWeakPassword):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
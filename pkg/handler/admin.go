@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"errors"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const (
+	adminUserPath              = "^/admin/users/([0-9]+)$"
+	adminUserDisablePath       = "^/admin/users/([0-9]+)/disable$"
+	adminUserEnablePath        = "^/admin/users/([0-9]+)/enable$"
+	adminUserPasswordResetPath = "^/admin/users/([0-9]+)/password-reset$"
+)
+
+var (
+	adminUserRe              = regexp.MustCompile(adminUserPath)
+	adminUserDisableRe       = regexp.MustCompile(adminUserDisablePath)
+	adminUserEnableRe        = regexp.MustCompile(adminUserEnablePath)
+	adminUserPasswordResetRe = regexp.MustCompile(adminUserPasswordResetPath)
+)
+
+type Admin struct {
+	services *service.Service
+	nats     *broker.Publisher
+	cfg      Config
+}
+
+func NewAdmin(services *service.Service, nats *broker.Publisher, cfg Config) *Admin {
+	return &Admin{services: services, nats: nats, cfg: cfg}
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/admin/users" || path == "/admin/users/":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		a.listUsers(w, r)
+	case adminUserRe.MatchString(path):
+		switch r.Method {
+		case http.MethodGet:
+			a.getUser(w, r)
+		case http.MethodDelete:
+			a.deleteUser(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case adminUserDisableRe.MatchString(path) && r.Method == http.MethodPost:
+		a.disableUser(w, r)
+	case adminUserEnableRe.MatchString(path) && r.Method == http.MethodPost:
+		a.enableUser(w, r)
+	case adminUserPasswordResetRe.MatchString(path) && r.Method == http.MethodPost:
+		a.forcePasswordReset(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// @Summary List users
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description list users with their item counts, optionally searching by username, name or email
+// @ID admin-list-users
+// @Accept  json
+// @Produce  json
+// @Param search query string false "part of the username, name or email"
+// @Param limit query integer false "page size, 50 by default, at most 200"
+// @Param offset query integer false "number of users to skip"
+// @Success 200 {object} models.AdminUserList
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users [get]
+func (a *Admin) listUsers(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset := 0, 0
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			newErrResponse(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			newErrResponse(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+	}
+
+	users, err := a.services.Admin.ListUsers(r.Context(), actorID, getClientIP(r, a.cfg.TrustProxyHeaders),
+		query.Get("search"), limit, offset)
+	if err != nil {
+		newAdminErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, users)
+}
+
+// @Summary Get user
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description get a user with their item counts
+// @ID admin-get-user
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "user id"
+// @Success 200 {object} models.AdminUser
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users/{id} [get]
+func (a *Admin) getUser(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := a.getIDs(w, r, adminUserPath)
+	if !ok {
+		return
+	}
+
+	user, err := a.services.Admin.GetUser(r.Context(), actorID, getClientIP(r, a.cfg.TrustProxyHeaders), userID)
+	if err != nil {
+		newAdminErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, user)
+}
+
+// @Summary Delete user
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description delete a user together with their items
+// @ID admin-delete-user
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "user id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users/{id} [delete]
+func (a *Admin) deleteUser(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := a.getIDs(w, r, adminUserPath)
+	if !ok {
+		return
+	}
+
+	if err := a.services.Admin.DeleteUser(r.Context(), actorID, getClientIP(r, a.cfg.TrustProxyHeaders), userID); err != nil {
+		newAdminErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Disable user
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description disable an account; the user can't sign in and their tokens stop working
+// @ID admin-disable-user
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "user id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users/{id}/disable [post]
+func (a *Admin) disableUser(w http.ResponseWriter, r *http.Request) {
+	a.setDisabled(w, r, adminUserDisablePath, true)
+}
+
+// @Summary Enable user
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description enable a disabled account
+// @ID admin-enable-user
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "user id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users/{id}/enable [post]
+func (a *Admin) enableUser(w http.ResponseWriter, r *http.Request) {
+	a.setDisabled(w, r, adminUserEnablePath, false)
+}
+
+func (a *Admin) setDisabled(w http.ResponseWriter, r *http.Request, path string, disabled bool) {
+	actorID, userID, ok := a.getIDs(w, r, path)
+	if !ok {
+		return
+	}
+
+	err := a.services.Admin.SetDisabled(r.Context(), actorID, getClientIP(r, a.cfg.TrustProxyHeaders), userID, disabled)
+	if err != nil {
+		newAdminErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Force password reset
+// @Security ApiKeyAuth
+// @Tags admin
+// @Description invalidate the user's password and email them a reset link
+// @ID admin-force-password-reset
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "user id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /admin/users/{id}/password-reset [post]
+func (a *Admin) forcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := a.getIDs(w, r, adminUserPasswordResetPath)
+	if !ok {
+		return
+	}
+
+	if err := a.services.Admin.ForcePasswordReset(r.Context(), actorID, getClientIP(r, a.cfg.TrustProxyHeaders), userID); err != nil {
+		newAdminErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// getIDs returns the id of the admin making the request and the user id from path.
+func (a *Admin) getIDs(w http.ResponseWriter, r *http.Request, path string) (int, int, bool) {
+	actorID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return 0, 0, false
+	}
+
+	userID, err := getPathParam(path, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return 0, 0, false
+	}
+
+	return actorID, userID, true
+}
+
+func newAdminErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAdminSelfAction), errors.Is(err, service.ErrNoEmail):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		newErrResponse(w, http.StatusNotFound, "user not found")
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
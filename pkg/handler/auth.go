@@ -2,21 +2,27 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
 	"github.com/NekruzRakhimov/todo_app/pkg/service"
 	"github.com/gin-gonic/gin"
-	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Auth struct {
 	services *service.Service
-	nats     *nats.Conn
+	nats     *broker.Publisher
+	cfg      Config
 }
 
-func NewAuth(services *service.Service, nats *nats.Conn) *Auth {
-	return &Auth{services: services, nats: nats}
+func NewAuth(services *service.Service, nats *broker.Publisher, cfg Config) *Auth {
+	return &Auth{services: services, nats: nats, cfg: cfg}
 }
 
 // @Summary SignUp
@@ -28,6 +34,7 @@ func NewAuth(services *service.Service, nats *nats.Conn) *Auth {
 // @Param input body models.User true "account info"
 // @Success 200 {integer} integer 1
 // @Failure 400,404 {object} errorResponse
+// @Failure 409 {object} errorResponse "code is username_taken or email_taken"
 // @Failure 500 {object} errorResponse
 // @Failure default {object} errorResponse
 // @Router /auth/sign-up [post]
@@ -44,27 +51,77 @@ func (a *Auth) signUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := a.services.Authorization.CreateUser(input)
+	id, err := a.services.Authorization.CreateUser(r.Context(), input)
+	if errors.Is(err, service.ErrUsernameTaken) {
+		newErrCodeResponse(w, http.StatusConflict, "username_taken", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		newErrCodeResponse(w, http.StatusConflict, "email_taken", err.Error())
+		return
+	}
 	if err != nil {
 		newErrResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if input.Email != "" {
+		if err = a.services.Account.SendVerificationEmail(r.Context(), id); err != nil {
+			logrus.Errorf("couldn't send verification email: %s", err.Error())
+		}
+	}
+
 	newDataResponse(w, dataResponse{Data: map[string]interface{}{"id": id}})
 }
 
-// @Summary SignUp
+// @Summary Check username
 // @Tags auth
-// @Description create account
-// @ID create-account
+// @Description check whether a username is free to sign up with; usernames are compared case-insensitively
+// @ID username-available
 // @Accept  json
 // @Produce  json
-// @Param input body models.User true "account info"
-// @Success 200 {integer} integer 1
+// @Param username query string true "username"
+// @Success 200 {object} dataResponse
 // @Failure 400,404 {object} errorResponse
 // @Failure 500 {object} errorResponse
 // @Failure default {object} errorResponse
-// @Router /auth/sign-up [post]
+// @Router /auth/username-available [get]
+func (a *Auth) usernameAvailable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		newErrResponse(w, http.StatusBadRequest, "username is required")
+		return
+	}
+
+	available, err := a.services.Authorization.UsernameAvailable(r.Context(), username)
+	if err != nil {
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	newDataResponse(w, dataResponse{Data: map[string]interface{}{"username": username, "available": available}})
+}
+
+// @Summary SignIn
+// @Tags auth
+// @Description login; accounts with 2FA get a challenge token to exchange at /auth/sign-in/2fa instead of the token
+// @ID login
+// @Accept  json
+// @Produce  json
+// @Param input body models.SignInInput true "credentials"
+// @Success 200 {object} dataResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 401 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 429 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /auth/sign-in [post]
 func (a *Auth) signIn(w http.ResponseWriter, r *http.Request) {
 	var input models.SignInInput
 	body, err := io.ReadAll(r.Body)
@@ -78,9 +135,65 @@ func (a *Auth) signIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := a.services.Authorization.GenerateToken(input.Username, input.Password)
+	result, err := a.services.Authorization.SignIn(r.Context(), input.Username, input.Password,
+		getClientIP(r, a.cfg.TrustProxyHeaders))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		newSignInErrResponse(w, err)
+		return
+	}
+
+	if result.TwoFactorRequired {
+		newDataResponse(w, dataResponse{Data: map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     result.ChallengeToken,
+		}})
+		return
+	}
+
+	newDataResponse(w, dataResponse{Data: map[string]interface{}{"token": result.Token}})
+}
+
+// @Summary SignIn second step
+// @Tags auth
+// @Description exchange the challenge token from /auth/sign-in and a TOTP or recovery code for the token
+// @ID login-two-factor
+// @Accept  json
+// @Produce  json
+// @Param input body models.TwoFactorSignInInput true "challenge token and code"
+// @Success 200 {object} dataResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 401 {object} errorResponse
+// @Failure 429 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /auth/sign-in/2fa [post]
+func (a *Auth) signInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.TwoFactorSignInInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.ChallengeToken == "" || input.Code == "" {
+		newErrResponse(w, http.StatusBadRequest, "challenge_token and code are required")
+		return
+	}
+
+	token, err := a.services.Authorization.VerifyTwoFactor(r.Context(), input.ChallengeToken, input.Code,
+		getClientIP(r, a.cfg.TrustProxyHeaders))
+	if err != nil {
+		newSignInErrResponse(w, err)
 		return
 	}
 
@@ -106,7 +219,7 @@ func (h *Handler) signUp(c *gin.Context) {
 		return
 	}
 
-	id, err := h.services.Authorization.CreateUser(input)
+	id, err := h.services.Authorization.CreateUser(c.Request.Context(), input)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -136,7 +249,11 @@ func (h *Handler) signIn(c *gin.Context) {
 		return
 	}
 
-	token, err := h.services.Authorization.GenerateToken(input.Username, input.Password)
+	token, err := h.services.Authorization.GenerateToken(c.Request.Context(), input.Username, input.Password, c.ClientIP())
+	if errors.Is(err, service.ErrTwoFactorRequired) {
+		newErrorResponse(c, http.StatusUnauthorized, err.Error())
+		return
+	}
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -146,3 +263,20 @@ func (h *Handler) signIn(c *gin.Context) {
 		"token": token,
 	})
 }
+
+func newSignInErrResponse(w http.ResponseWriter, err error) {
+	var locked *service.LoginLockedError
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidChallenge),
+		errors.Is(err, service.ErrInvalidTwoFactorCode):
+		newErrResponse(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		newErrResponse(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &locked):
+		retryAfter := int(math.Ceil(time.Until(locked.Until).Seconds()))
+		w.Header().Set(retryAfterHeader, strconv.Itoa(retryAfter))
+		newErrResponse(w, http.StatusTooManyRequests, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const (
+	exportPath         = "^/api/me/exports/([0-9]+)$"
+	exportDownloadPath = "^/exports/([0-9]+)/download$"
+)
+
+var (
+	exportRe         = regexp.MustCompile(exportPath)
+	exportDownloadRe = regexp.MustCompile(exportDownloadPath)
+)
+
+type Export struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewExport(services *service.Service, nats *broker.Publisher) *Export {
+	return &Export{services: services, nats: nats}
+}
+
+func (e *Export) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/api/me/export" && r.Method == http.MethodPost:
+		e.requestExport(w, r)
+	case path == "/api/me/exports" && r.Method == http.MethodGet:
+		e.getAllExports(w, r)
+	case exportRe.MatchString(path) && r.Method == http.MethodGet:
+		e.getExportByID(w, r)
+	case path == "/api/me/export" || path == "/api/me/exports" || exportRe.MatchString(path):
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// @Summary Request data export
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description start building a zip of the profile, all items including deleted ones and the account history, as JSON and CSV
+// @ID request-export
+// @Accept  json
+// @Produce  json
+// @Success 202 {object} models.DataExport
+// @Failure 400,404 {object} errorResponse
+// @Failure 409 {object} errorResponse
+// @Failure 503 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me/export [post]
+func (e *Export) requestExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	export, err := e.services.Export.Request(r.Context(), userID)
+	if err != nil {
+		newExportErrResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/me/exports/%d", export.ID))
+	newJSONResponse(w, http.StatusAccepted, export)
+}
+
+// @Summary Get data exports
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description list data exports with their status and, once ready, a signed download link
+// @ID get-all-exports
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.DataExport
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me/exports [get]
+func (e *Export) getAllExports(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exports, err := e.services.Export.GetAll(r.Context(), userID)
+	if err != nil {
+		newExportErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, exports)
+}
+
+// @Summary Get data export by ID
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description get a data export's status and, once ready, its signed download link
+// @ID get-export-by-id
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "export id"
+// @Success 200 {object} models.DataExport
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me/exports/{id} [get]
+func (e *Export) getExportByID(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exportID, err := getPathParam(exportPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	export, err := e.services.Export.GetByID(r.Context(), userID, exportID)
+	if err != nil {
+		newExportErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, export)
+}
+
+// @Summary Download data export
+// @Tags profile
+// @Description download an export archive through the signed link from the export; no auth header is needed
+// @ID download-export
+// @Produce  application/zip
+// @Param id path integer true "export id"
+// @Param expires query integer true "link expiry, unix time"
+// @Param signature query string true "link signature"
+// @Success 200 {file} file
+// @Failure 400,404 {object} errorResponse
+// @Failure 403 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /exports/{id}/download [get]
+func (e *Export) downloadExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !exportDownloadRe.MatchString(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	exportID, err := getPathParam(exportDownloadPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, "invalid expires")
+		return
+	}
+
+	archive, err := e.services.Export.Open(r.Context(), exportID, expires, r.URL.Query().Get("signature"))
+	if err != nil {
+		newExportErrResponse(w, err)
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, exportID))
+	if _, err = io.Copy(w, archive); err != nil {
+		logrus.Errorf("couldn't send export %d: %s", exportID, err.Error())
+	}
+}
+
+func newExportErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrExportInProgress):
+		newErrResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrExportNotReady):
+		newErrResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidExportLink):
+		newErrResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrStopped):
+		newErrResponse(w, http.StatusServiceUnavailable, "exports are busy, try again later")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		newErrResponse(w, http.StatusNotFound, "export not found")
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -2,37 +2,108 @@ package handler
 
 import (
 	_ "github.com/NekruzRakhimov/todo_app/docs"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/health"
+	"github.com/NekruzRakhimov/todo_app/pkg/metrics"
 	"github.com/NekruzRakhimov/todo_app/pkg/service"
-	"github.com/nats-io/nats.go"
 	"github.com/swaggo/http-swagger"
 	"net/http"
 )
 
+type Config struct {
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For / X-Real-IP.
+	// Enable it only behind a proxy that sets them.
+	TrustProxyHeaders bool
+	// AllowedOrigins are the origins, e.g. "https://app.example.com", of web
+	// apps other than the API's own host that may open the WebSocket stream.
+	AllowedOrigins []string
+}
+
 type Handler struct {
 	services *service.Service
-	nats     *nats.Conn
+	nats     *broker.Publisher
+	health   *health.Checker
+	cfg      Config
 }
 
-func NewHandler(services *service.Service, nats *nats.Conn) *Handler {
-	return &Handler{services: services, nats: nats}
+func NewHandler(services *service.Service, nats *broker.Publisher, checker *health.Checker, cfg Config) *Handler {
+	return &Handler{services: services, nats: nats, health: checker, cfg: cfg}
 }
 
 func (h *Handler) InitRoutes() *http.ServeMux {
 	sm := http.NewServeMux()
 
 	item := NewItem(h.services, h.nats)
-	auth := NewAuth(h.services, h.nats)
+	auth := NewAuth(h.services, h.nats, h.cfg)
+	webhook := NewWebhook(h.services, h.nats)
+	stream := NewStream(h.services, h.nats, h.cfg)
+	itemSync := NewSync(h.services, h.nats)
+	twoFactor := NewTwoFactor(h.services, h.nats)
+	accessToken := NewAccessToken(h.services, h.nats)
+	admin := NewAdmin(h.services, h.nats, h.cfg)
+	profile := NewProfile(h.services, h.nats)
+	export := NewExport(h.services, h.nats)
+	healthCheck := NewHealth(h.health)
+
+	// handle registers handler with spans and metrics named after its pattern
+	handle := func(pattern string, handler http.Handler) {
+		sm.Handle(pattern, observe(pattern, handler))
+	}
 
-	sm.Handle("/swagger/", httpSwagger.Handler(
+	handle("/swagger/", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8880/swagger/doc.json"),
 	))
 
-	sm.HandleFunc("/auth/sign-up", auth.signUp)
-	sm.HandleFunc("/auth/sign-in", auth.signIn)
+	handle("/metrics", metrics.Handler())
+	handle("/healthz", http.HandlerFunc(healthCheck.live))
+	handle("/readyz", http.HandlerFunc(healthCheck.ready))
+	handle("/version", http.HandlerFunc(healthCheck.version))
+
+	handle("/auth/sign-up", h.rateLimit("auth", http.HandlerFunc(auth.signUp)))
+	handle("/auth/username-available", h.rateLimit("auth", http.HandlerFunc(auth.usernameAvailable)))
+	handle("/auth/sign-in", h.rateLimit("auth", http.HandlerFunc(auth.signIn)))
+	handle("/auth/sign-in/2fa", h.rateLimit("auth", http.HandlerFunc(auth.signInTwoFactor)))
+	handle("/auth/password/forgot", h.rateLimit("auth", http.HandlerFunc(auth.forgotPassword)))
+	handle("/auth/password/reset", h.rateLimit("auth", http.HandlerFunc(auth.resetPassword)))
+	handle("/auth/verify-email", h.rateLimit("auth", http.HandlerFunc(auth.verifyEmail)))
+
+	handle("/api/items", item.middleware(h.require(itemsPermission,
+		h.rateLimit("api", item.idempotent(http.HandlerFunc(item.ItemsCR))))))
+	handle("/api/items/", item.middleware(h.require(itemsPermission, h.rateLimit("api", item))))
+	handle("/api/items/bulk", item.middleware(h.require(itemsPermission,
+		h.rateLimit("bulk", item.idempotent(http.HandlerFunc(item.bulkCreateItems))))))
+	handle("/api/items/stream", stream.middleware(item, h.require(itemsPermission,
+		h.rateLimit("api", http.HandlerFunc(stream.streamItemEvents)))))
+	handle("/api/items/stream/ws", stream.middleware(item, h.require(itemsPermission,
+		h.rateLimit("api", http.HandlerFunc(stream.streamItemEventsWS)))))
+	handle("/api/items/stream/token", item.middleware(h.require(streamTokenPermission,
+		h.rateLimit("api", http.HandlerFunc(stream.issueToken)))))
+
+	handle("/api/me", item.middleware(h.require(accountPermission, h.rateLimit("api", profile))))
+	handle("/api/me/", item.middleware(h.require(accountPermission, h.rateLimit("api", profile))))
+
+	handle("/api/me/export", item.middleware(h.require(accountPermission, h.rateLimit("api", export))))
+	handle("/api/me/exports", item.middleware(h.require(accountPermission, h.rateLimit("api", export))))
+	handle("/api/me/exports/", item.middleware(h.require(accountPermission, h.rateLimit("api", export))))
+	handle("/exports/", h.rateLimit("api", http.HandlerFunc(export.downloadExport)))
+
+	handle("/api/2fa/enroll", item.middleware(h.require(accountPermission,
+		h.rateLimit("api", http.HandlerFunc(twoFactor.enroll)))))
+	handle("/api/2fa/confirm", item.middleware(h.require(accountPermission,
+		h.rateLimit("api", http.HandlerFunc(twoFactor.confirm)))))
+	handle("/api/2fa/disable", item.middleware(h.require(accountPermission,
+		h.rateLimit("api", http.HandlerFunc(twoFactor.disable)))))
+
+	handle("/api/tokens", item.middleware(h.require(accountPermission, h.rateLimit("api", accessToken))))
+	handle("/api/tokens/", item.middleware(h.require(accountPermission, h.rateLimit("api", accessToken))))
+
+	handle("/api/sync", item.middleware(h.require(itemsPermission, h.rateLimit("api", itemSync))))
+
+	handle("/api/webhooks", item.middleware(h.require(webhooksPermission, h.rateLimit("api", webhook))))
+	handle("/api/webhooks/", item.middleware(h.require(webhooksPermission, h.rateLimit("api", webhook))))
 
-	sm.Handle("/api/items", item.middleware(http.HandlerFunc(item.ItemsCR)))
-	sm.Handle("/api/items/", item.middleware(item))
-	sm.Handle("/api/items/bulk", item.middleware(http.HandlerFunc(item.bulkCreateItems)))
+	handle("/admin/users", item.middleware(h.require(adminPermission, h.rateLimit("api", admin))))
+	handle("/admin/users/", item.middleware(h.require(adminPermission, h.rateLimit("api", admin))))
 
 	return sm
 }
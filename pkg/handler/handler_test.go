@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/health"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestRoutes serves the API from the SQLite db, publishing with publisher,
+// and returns it with a token of a user signed up in it.
+func newTestRoutes(t *testing.T, db *gorm.DB, publisher *broker.Publisher,
+	cfg Config) (*http.ServeMux, *service.Service, string) {
+	runner := jobs.NewRunner(1, 1)
+	t.Cleanup(func() { _ = runner.Shutdown(context.Background()) })
+
+	services := service.NewService(repository.NewSQLiteRepository(db), nil, nil, runner, service.Config{
+		Token: service.TokenConfig{SigningKey: []byte("test"), TTL: time.Hour},
+		Lockout: service.LockoutConfig{
+			MaxFailures: 5, MaxIPFailures: 5, FailureWindow: time.Minute,
+			LockoutDuration: time.Minute, MaxLockoutDuration: time.Minute,
+		},
+		Stream:      service.StreamConfig{HistorySize: 100, BufferSize: 100},
+		Idempotency: service.IdempotencyConfig{TTL: time.Hour, Lease: time.Minute},
+	})
+
+	ctx := context.Background()
+	_, err := services.Authorization.CreateUser(ctx, models.User{Name: "Tester", Username: "tester", Password: "secret"})
+	require.NoError(t, err)
+	token, err := services.Authorization.GenerateToken(ctx, "tester", "secret", "")
+	require.NoError(t, err)
+
+	routes := NewHandler(services, publisher, health.NewChecker(time.Second), cfg).InitRoutes()
+	return routes, services, token
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/NekruzRakhimov/todo_app/pkg/health"
+	"net/http"
+)
+
+type Health struct {
+	checker *health.Checker
+}
+
+func NewHealth(checker *health.Checker) *Health {
+	return &Health{checker: checker}
+}
+
+// @Summary Liveness
+// @Tags health
+// @Description reports that the process is up; it doesn't check dependencies
+// @ID healthz
+// @Produce  json
+// @Success 200 {object} statusResponse
+// @Router /healthz [get]
+func (h *Health) live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, statusResponse{Status: health.StatusUp})
+}
+
+// @Summary Readiness
+// @Tags health
+// @Description checks the database and NATS; 503 while a required dependency is down or the server is shutting down
+// @ID readyz
+// @Produce  json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *Health) ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, ok := h.checker.Ready(r.Context())
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+
+	newJSONResponse(w, status, report)
+}
+
+// @Summary Version
+// @Tags health
+// @Description the version and build details of the running binary
+// @ID version
+// @Produce  json
+// @Success 200 {object} health.BuildInfo
+// @Router /version [get]
+func (h *Health) version(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, health.Build())
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	contentTypeHeader        = "Content-Type"
+)
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.statusCode == 0 {
+		rr.statusCode = statusCode
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.statusCode == 0 {
+		rr.statusCode = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// idempotent stores the first response to a POST carrying an Idempotency-Key
+// and replays it to retries of the same request. It must run after middleware.
+func (i *Item) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := i.getUserId(r)
+		if err != nil {
+			newErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			newErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+
+		record, err := i.services.Idempotency.Begin(r.Context(), userID, key, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			newIdempotencyErrResponse(w, err)
+			return
+		}
+
+		if record.Completed {
+			if record.ContentType != "" {
+				w.Header().Set(contentTypeHeader, record.ContentType)
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(record.StatusCode)
+			_, _ = w.Write(record.ResponseBody)
+			return
+		}
+
+		// the outcome is stored even if the client has gone away meanwhile
+		ctx := tracing.Detach(r.Context())
+
+		// handlers answer 5xx only when nothing was committed, so server errors
+		// and panics are not stored and the client can retry them
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := i.services.Idempotency.Release(ctx, record); err != nil {
+				logrus.Errorf("couldn't release idempotency key: %s", err.Error())
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+			return
+		}
+
+		record.StatusCode = rec.statusCode
+		record.ContentType = w.Header().Get(contentTypeHeader)
+		record.ResponseBody = rec.body.Bytes()
+		if err = i.services.Idempotency.Complete(ctx, record); err != nil {
+			logrus.Errorf("couldn't store idempotent response: %s", err.Error())
+			return
+		}
+		stored = true
+	})
+}
+
+func newIdempotencyErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidIdempotencyKey):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		newErrResponse(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+		newErrResponse(w, http.StatusConflict, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
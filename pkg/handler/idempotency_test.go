@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotent_PublishFailureAfterCommit(t *testing.T) {
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	// a required broker that isn't connected fails every publish
+	routes, services, token := newTestRoutes(t, db, broker.NewPublisher(nil, false), Config{})
+
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/items", strings.NewReader(`{"title":"once"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(idempotencyKeyHeader, "create-once")
+		res := httptest.NewRecorder()
+		routes.ServeHTTP(res, req)
+		return res
+	}
+
+	first := create()
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+
+	retry := create()
+	require.Equal(t, http.StatusOK, retry.Code, retry.Body.String())
+	require.Equal(t, "true", retry.Header().Get(idempotentReplayedHeader))
+	require.JSONEq(t, first.Body.String(), retry.Body.String())
+
+	identity, err := services.Authorization.ParseToken(context.Background(), token)
+	require.NoError(t, err)
+	items, err := services.TodoItem.GetAll(context.Background(), identity.UserID)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
 	"github.com/NekruzRakhimov/todo_app/pkg/service"
-	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 	"io"
 	"net/http"
 	"regexp"
@@ -21,10 +23,10 @@ const (
 
 type Item struct {
 	services *service.Service
-	nats     *nats.Conn
+	nats     *broker.Publisher
 }
 
-func NewItem(services *service.Service, nats *nats.Conn) *Item {
+func NewItem(services *service.Service, nats *broker.Publisher) *Item {
 	return &Item{services: services, nats: nats}
 }
 
@@ -75,6 +77,7 @@ func (i *Item) ItemsCR(w http.ResponseWriter, r *http.Request) {
 // @Accept  json
 // @Produce  json
 // @Param input body models.TodoItem true "item info"
+// @Param Idempotency-Key header string false "key to safely retry the request"
 // @Success 200 {integer} integer 1
 // @Failure 400,404 {object} errorResponse
 // @Failure 500 {object} errorResponse
@@ -101,17 +104,15 @@ func (i *Item) createItem(w http.ResponseWriter, r *http.Request) {
 
 	input.UserID = userID
 
-	itemID, err := i.services.TodoItem.Create(input)
+	itemID, err := i.services.TodoItem.Create(r.Context(), input)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("create_item",
-		[]byte(fmt.Sprintf("создана задача с id = %d", itemID))); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	input.ID = itemID
+	i.notify(r.Context(), userID, models.EventItemCreated, input)
+	i.publish(r.Context(), "create_item", []byte(fmt.Sprintf("создана задача с id = %d", itemID)))
 
 	newDataResponse(w, dataResponse{Data: map[string]interface{}{"item_id": itemID}})
 }
@@ -135,13 +136,13 @@ func (i *Item) getAllItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	items, err := i.services.TodoItem.GetAll(userID)
+	items, err := i.services.TodoItem.GetAll(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("get_all_items",
+	if err = i.nats.Publish(r.Context(), "get_all_items",
 		[]byte(fmt.Sprintf("запрошены все задачи пользователя с id = %d", userID))); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -185,13 +186,13 @@ func (i *Item) getItemByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := i.services.TodoItem.GetByID(userID, itemID)
+	item, err := i.services.TodoItem.GetByID(r.Context(), userID, itemID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("get_item_by_id",
+	if err = i.nats.Publish(r.Context(), "get_item_by_id",
 		[]byte(fmt.Sprintf("запрошена задача с id = %d", itemID))); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -217,6 +218,7 @@ func (i *Item) getItemByID(w http.ResponseWriter, r *http.Request) {
 // @Accept  json
 // @Produce  json
 // @Param input body models.TodoItemList true "item info"
+// @Param Idempotency-Key header string false "key to safely retry the request"
 // @Success 200 {object} statusResponse
 // @Failure 400,404 {object} errorResponse
 // @Failure 500 {object} errorResponse
@@ -241,16 +243,18 @@ func (i *Item) bulkCreateItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = i.services.TodoItem.BulkCreate(userID, input); err != nil {
+	ids, err := i.services.TodoItem.BulkCreate(r.Context(), userID, input)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("bulk_create_item",
-		[]byte(fmt.Sprintf("bulk создание задач от пользователя с id = %d", userID))); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	for n, item := range input {
+		item.ID = ids[n]
+		i.notify(r.Context(), userID, models.EventItemCreated, item)
 	}
+	i.publish(r.Context(), "bulk_create_item",
+		[]byte(fmt.Sprintf("bulk создание задач от пользователя с id = %d", userID)))
 
 	newStatusResponse(w, "ok")
 }
@@ -288,16 +292,18 @@ func (i *Item) updateItemStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = i.services.TodoItem.ChangeStatus(userID, itemID, status); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err = i.services.TodoItem.ChangeStatus(r.Context(), userID, itemID, status); err != nil {
+		writeItemErr(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("update_item_status",
-		[]byte(fmt.Sprintf("изменент статус задачи с id = %d на значение = %t", itemID, status))); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	event := models.EventItemUpdated
+	if status {
+		event = models.EventItemCompleted
 	}
+	i.notify(r.Context(), userID, event, map[string]interface{}{"id": itemID, "done": status})
+	i.publish(r.Context(), "update_item_status",
+		[]byte(fmt.Sprintf("изменент статус задачи с id = %d на значение = %t", itemID, status)))
 
 	newStatusResponse(w, "ok")
 }
@@ -341,16 +347,14 @@ func (i *Item) updateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = i.services.TodoItem.Update(userID, itemID, input); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err = i.services.TodoItem.Update(r.Context(), userID, itemID, input); err != nil {
+		writeItemErr(w, err, http.StatusBadRequest)
 		return
 	}
 
-	if err = i.nats.Publish("update_item",
-		[]byte(fmt.Sprintf("изменена задача с id = %d", itemID))); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	input.ID = itemID
+	i.notify(r.Context(), userID, models.EventItemUpdated, input)
+	i.publish(r.Context(), "update_item", []byte(fmt.Sprintf("изменена задача с id = %d", itemID)))
 
 	newStatusResponse(w, "ok")
 }
@@ -381,20 +385,44 @@ func (i *Item) deleteItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = i.services.TodoItem.Delete(userID, itemID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err = i.services.TodoItem.Delete(r.Context(), userID, itemID); err != nil {
+		writeItemErr(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	if err = i.nats.Publish("delete_item",
-		[]byte(fmt.Sprintf("удалена задача с id = %d", itemID))); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	i.notify(r.Context(), userID, models.EventItemDeleted, map[string]interface{}{"id": itemID})
+	i.publish(r.Context(), "delete_item", []byte(fmt.Sprintf("удалена задача с id = %d", itemID)))
 
 	newStatusResponse(w, "ok")
 }
 
+// writeItemErr answers a failed write to an item with status, or 404 when the
+// user has no such item, e.g. it was already removed.
+func writeItemErr(w http.ResponseWriter, err error, status int) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// publish announces a write that is already committed. A failure is only
+// logged: answering 500 would have the client retry a write that succeeded.
+func (i *Item) publish(ctx context.Context, subject string, data []byte) {
+	if err := i.nats.Publish(ctx, subject, data); err != nil {
+		logrus.Errorf("couldn't publish to %s: %s", subject, err.Error())
+	}
+}
+
+func (i *Item) notify(ctx context.Context, userID int, event string, data interface{}) {
+	notifyItemEvent(ctx, i.services, userID, event, data)
+}
+
+// notifyItemEvent fans an item event out to the user's webhooks and live streams.
+func notifyItemEvent(ctx context.Context, services *service.Service, userID int, event string, data interface{}) {
+	services.Webhook.Dispatch(ctx, userID, event, data)
+	services.Stream.Publish(userID, event, data)
+}
+
 func (i *Item) middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Получаем значение токена из заголовка Authorization
@@ -416,14 +444,30 @@ func (i *Item) middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := i.services.Authorization.ParseToken(headerParts[1])
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+		var identity models.Identity
+		if strings.HasPrefix(headerParts[1], service.AccessTokenPrefix) {
+			token, err := i.services.AccessToken.Authenticate(r.Context(), headerParts[1])
+			if errors.Is(err, service.ErrInvalidAccessToken) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			identity = models.Identity{UserID: token.UserID, Scopes: token.Scopes}
+		} else {
+			var err error
+			identity, err = i.services.Authorization.ParseToken(r.Context(), headerParts[1])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
 		}
 
 		// Создаем контекст с токеном и передаем его следующему обработчику
-		ctx := context.WithValue(r.Context(), userCtx, userID)
+		ctx := context.WithValue(r.Context(), userCtx, identity.UserID)
+		ctx = context.WithValue(ctx, scopesCtx, identity.Scopes)
 		r = r.WithContext(ctx)
 
 		// Передаем управление следующему обработчику в цепочке
@@ -432,6 +476,10 @@ func (i *Item) middleware(next http.Handler) http.Handler {
 }
 
 func (i *Item) getUserId(r *http.Request) (int, error) {
+	return getRequestUserId(r)
+}
+
+func getRequestUserId(r *http.Request) (int, error) {
 	idNil := r.Context().Value(userCtx)
 	if idNil == nil {
 		return 0, errors.New("токен не найден в контексте")
@@ -446,21 +494,38 @@ func (i *Item) getUserId(r *http.Request) (int, error) {
 }
 
 func getPathParam(path string, r *http.Request) (int, error) {
+	params, err := getPathParams(path, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(params) != 1 {
+		return 0, errors.New("invalid URI")
+	}
+
+	return params[0], nil
+}
+
+// getPathParams returns every integer captured by the groups of path.
+func getPathParams(path string, r *http.Request) ([]int, error) {
 	reg := regexp.MustCompile(path)
 	g := reg.FindAllStringSubmatch(r.URL.Path, -1)
 	if len(g) != 1 {
-		return 0, errors.New("invalid URI")
+		return nil, errors.New("invalid URI")
 	}
 
-	if len(g[0]) != 2 {
-		return 0, errors.New("invalid URI")
+	if len(g[0]) < 2 {
+		return nil, errors.New("invalid URI")
 	}
 
-	idString := g[0][1]
-	id, err := strconv.Atoi(idString)
-	if err != nil {
-		return 0, errors.New("invalid URI")
+	params := make([]int, 0, len(g[0])-1)
+	for _, idString := range g[0][1:] {
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			return nil, errors.New("invalid URI")
+		}
+		params = append(params, id)
 	}
 
-	return id, nil
+	return params, nil
 }
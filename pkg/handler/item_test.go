@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestItem_NotifiesCommittedWritesOnly(t *testing.T) {
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	// a required broker that isn't connected fails every publish
+	routes, services, token := newTestRoutes(t, db, broker.NewPublisher(nil, false), Config{})
+	identity, err := services.Authorization.ParseToken(context.Background(), token)
+	require.NoError(t, err)
+
+	_, events, unsubscribe := services.Stream.Subscribe(identity.UserID, 0)
+	defer unsubscribe()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		routes.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(http.MethodPost, "/api/items", `{"title":"first"}`)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	var created struct {
+		Data struct {
+			ItemID int `json:"item_id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+	itemPath := "/api/items/" + strconv.Itoa(created.Data.ItemID)
+
+	res = serve(http.MethodDelete, itemPath, "")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+
+	// the item is gone, so nothing changes and nothing is announced
+	require.Equal(t, http.StatusNotFound, serve(http.MethodDelete, itemPath, "").Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPut, itemPath, `{"title":"again"}`).Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPatch, itemPath+"?status=true", "").Code)
+
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	require.Equal(t, []string{models.EventItemCreated, models.EventItemDeleted}, types)
+}
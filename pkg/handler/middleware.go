@@ -2,6 +2,7 @@ package handler
 
 import (
 	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strings"
@@ -10,8 +11,54 @@ import (
 const (
 	authorizationHeader = "Authorization"
 	userCtx             = "userID"
+	scopesCtx           = "scopes"
 )
 
+// permission is what a route needs from the token: the read scope for GET and
+// HEAD requests and the write scope for everything else.
+type permission struct {
+	read  string
+	write string
+}
+
+var (
+	itemsPermission    = permission{read: models.ScopeItemsRead, write: models.ScopeItemsWrite}
+	webhooksPermission = permission{read: models.ScopeWebhooksRead, write: models.ScopeWebhooksWrite}
+	accountPermission  = permission{read: models.ScopeAccount, write: models.ScopeAccount}
+	adminPermission    = permission{read: models.ScopeAdmin, write: models.ScopeAdmin}
+	// streamTokenPermission lets tokens that may read items get a stream token.
+	streamTokenPermission = permission{read: models.ScopeItemsRead, write: models.ScopeItemsRead}
+)
+
+// require rejects requests whose token lacks the scope perm asks for. It
+// must run after Item.middleware, which puts the scopes in the context.
+func (h *Handler) require(perm permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := perm.write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = perm.read
+		}
+
+		scopes, _ := r.Context().Value(scopesCtx).([]string)
+		if !hasScope(scopes, scope) {
+			newErrResponse(w, http.StatusForbidden, "insufficient scope: this request requires the "+scope+" scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (h *Handler) userIdentity(c *gin.Context) {
 	header := c.GetHeader(authorizationHeader)
 	if header == "" {
@@ -30,13 +77,13 @@ func (h *Handler) userIdentity(c *gin.Context) {
 		return
 	}
 
-	userID, err := h.services.Authorization.ParseToken(headerParts[1])
+	identity, err := h.services.Authorization.ParseToken(c.Request.Context(), headerParts[1])
 	if err != nil {
 		newErrorResponse(c, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	c.Set(userCtx, userID)
+	c.Set(userCtx, identity.UserID)
 }
 
 func getUserId(c *gin.Context) (int, error) {
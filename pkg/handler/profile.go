@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Profile struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewProfile(services *service.Service, nats *broker.Publisher) *Profile {
+	return &Profile{services: services, nats: nats}
+}
+
+func (p *Profile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/me", "/api/me/":
+		switch r.Method {
+		case http.MethodGet:
+			p.getProfile(w, r)
+		case http.MethodPatch:
+			p.updateProfile(w, r)
+		case http.MethodDelete:
+			p.deleteAccount(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case "/api/me/password":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		p.changePassword(w, r)
+	case "/api/me/restore":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		p.restoreAccount(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// @Summary Get profile
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description get the signed-in user's profile
+// @ID get-profile
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.Profile
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me [get]
+func (p *Profile) getProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := p.services.Profile.Get(r.Context(), userID)
+	if err != nil {
+		newProfileErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, profile)
+}
+
+// @Summary Update profile
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description change the name, timezone, locale or preferences; fields that are left out aren't changed
+// @ID update-profile
+// @Accept  json
+// @Produce  json
+// @Param input body models.ProfileUpdateInput true "fields to change"
+// @Success 200 {object} models.Profile
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me [patch]
+func (p *Profile) updateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.ProfileUpdateInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := p.services.Profile.Update(r.Context(), userID, input)
+	if err != nil {
+		newProfileErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, profile)
+}
+
+// @Summary Change password
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description change the password; requires the current one
+// @ID change-password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ChangePasswordInput true "current and new password"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me/password [post]
+func (p *Profile) changePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.ChangePasswordInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = p.services.Profile.ChangePassword(r.Context(), userID, input.CurrentPassword, input.NewPassword); err != nil {
+		newProfileErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Delete account
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description schedule the account and all its items for deletion; it can be restored until the grace period is over
+// @ID delete-account
+// @Accept  json
+// @Produce  json
+// @Param input body models.DeleteAccountInput true "current password"
+// @Success 202 {object} dataResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me [delete]
+func (p *Profile) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.DeleteAccountInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleteAfter, err := p.services.Profile.ScheduleDeletion(r.Context(), userID, input.Password)
+	if err != nil {
+		newProfileErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusAccepted, dataResponse{Data: map[string]interface{}{
+		"delete_after": deleteAfter.UTC().Format(time.RFC3339),
+	}})
+}
+
+// @Summary Restore account
+// @Security ApiKeyAuth
+// @Tags profile
+// @Description cancel a scheduled account deletion
+// @ID restore-account
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/me/restore [post]
+func (p *Profile) restoreAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = p.services.Profile.CancelDeletion(r.Context(), userID); err != nil {
+		newProfileErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+func newProfileErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidName), errors.Is(err, service.ErrInvalidTimezone),
+		errors.Is(err, service.ErrInvalidLocale), errors.Is(err, service.ErrInvalidPreferences),
+		errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrWeakPassword):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+)
+
+// rateLimit applies the token bucket of the route group. Groups keyed by user
+// must be wrapped by the auth middleware.
+func (h *Handler) rateLimit(group string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := h.services.RateLimit.Rule(group)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + getClientIP(r, h.cfg.TrustProxyHeaders)
+		if rule.KeyBy == service.RateLimitByUser {
+			if userID, err := getRequestUserId(r); err == nil {
+				key = "user:" + strconv.Itoa(userID)
+			}
+		}
+
+		result, err := h.services.RateLimit.Allow(r.Context(), group, key)
+		if err != nil {
+			logrus.Errorf("rate limit store failed, allowing request: %s", err.Error())
+		}
+
+		if result.Limit > 0 {
+			w.Header().Set(rateLimitLimitHeader, strconv.Itoa(result.Limit))
+			w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+			w.Header().Set(rateLimitResetHeader, strconv.Itoa(int(result.Reset.Seconds())))
+		}
+
+		if !result.Allowed {
+			w.Header().Set(retryAfterHeader, strconv.Itoa(int(result.RetryAfter.Seconds())))
+			newErrResponse(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getClientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -9,6 +9,8 @@ import (
 
 type errorResponse struct {
 	Message string `json:"message"`
+	// Code is a stable identifier for errors clients are expected to handle.
+	Code string `json:"code,omitempty"`
 }
 
 type statusResponse struct {
@@ -21,7 +23,7 @@ type dataResponse struct {
 
 func newErrorResponse(c *gin.Context, statusCode int, message string) {
 	logrus.Error(message)
-	c.AbortWithStatusJSON(statusCode, errorResponse{message})
+	c.AbortWithStatusJSON(statusCode, errorResponse{Message: message})
 }
 
 func newErrResponse(w http.ResponseWriter, statusCode int, message string) {
@@ -32,6 +34,10 @@ func newErrResponse(w http.ResponseWriter, statusCode int, message string) {
 	}
 }
 
+func newErrCodeResponse(w http.ResponseWriter, statusCode int, code, message string) {
+	newJSONResponse(w, statusCode, errorResponse{Message: message, Code: code})
+}
+
 func newStatusResponse(w http.ResponseWriter, status string) {
 	body, err := json.Marshal(statusResponse{Status: status})
 	if err != nil {
@@ -49,3 +55,11 @@ func newDataResponse(w http.ResponseWriter, data dataResponse) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+func newJSONResponse(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("couldn't write response: %s", err.Error())
+	}
+}
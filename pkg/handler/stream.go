@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamRetryMillis       = 3000
+	lastEventIDHeader       = "Last-Event-ID"
+
+	streamTokenParam  = "access_token"
+	streamTokenCookie = "stream_token"
+	streamPath        = "/api/items/stream"
+)
+
+type Stream struct {
+	services *service.Service
+	nats     *broker.Publisher
+	cfg      Config
+}
+
+func NewStream(services *service.Service, nats *broker.Publisher, cfg Config) *Stream {
+	return &Stream{services: services, nats: nats, cfg: cfg}
+}
+
+// middleware authenticates the stream routes like Item.middleware, but also
+// takes a stream token from the access_token query param or the stream_token
+// cookie, as browsers can't set headers on EventSource and WebSocket.
+func (st *Stream) middleware(item *Item, next http.Handler) http.Handler {
+	withHeader := item.middleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(streamTokenParam)
+		if token == "" {
+			if cookie, err := r.Cookie(streamTokenCookie); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		if token == "" || r.Header.Get(authorizationHeader) != "" {
+			withHeader.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := st.services.Authorization.ParseStreamToken(r.Context(), token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userCtx, identity.UserID)
+		ctx = context.WithValue(ctx, scopesCtx, identity.Scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// @Summary Issue a stream token
+// @Security ApiKeyAuth
+// @Tags items
+// @Description short-lived token opening the item streams, for clients that can't set the Authorization header; pass it as the access_token query param or use the stream_token cookie set here
+// @ID stream-token
+// @Produce  json
+// @Success 200 {object} models.StreamToken
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/items/stream/token [post]
+func (st *Stream) issueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := st.services.Authorization.IssueStreamToken(userID)
+	if err != nil {
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     streamTokenCookie,
+		Value:    token.Token,
+		Path:     streamPath,
+		Expires:  token.ExpiresAt,
+		Secure:   r.TLS != nil || (st.cfg.TrustProxyHeaders && r.Header.Get("X-Forwarded-Proto") == "https"),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	newJSONResponse(w, http.StatusOK, token)
+}
+
+// @Summary Stream item events
+// @Security ApiKeyAuth
+// @Tags items
+// @Description server-sent events feed of the user's item changes; resume with the Last-Event-ID header. After a stream.resync event fetch /api/sync. Events only cover writes handled by the same instance.
+// @ID stream-items
+// @Produce  text/event-stream
+// @Param Last-Event-ID header integer false "last received event id"
+// @Param last_event_id query integer false "last received event id"
+// @Param access_token query string false "stream token, instead of the Authorization header"
+// @Success 200 {object} models.ItemEvent
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/items/stream [get]
+func (st *Stream) streamItemEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID, err := getLastEventID(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	if err = rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	missed, events, cancel := st.services.Stream.Subscribe(userID, lastEventID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis); err != nil {
+		return
+	}
+
+	for _, event := range missed {
+		if err = writeSSEEvent(w, event); err != nil {
+			return
+		}
+	}
+
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			err = writeSSEEvent(w, event)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err != nil {
+			return
+		}
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// @Summary Stream item events over WebSocket
+// @Security ApiKeyAuth
+// @Tags items
+// @Description WebSocket feed of the user's item changes; resume with the last_event_id query param. After a stream.resync event fetch /api/sync. Events only cover writes handled by the same instance.
+// @ID stream-items-ws
+// @Param last_event_id query integer false "last received event id"
+// @Param access_token query string false "stream token, instead of the Authorization header"
+// @Success 101 {object} models.ItemEvent
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/items/stream/ws [get]
+func (st *Stream) streamItemEventsWS(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID, err := getLastEventID(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	websocket.Server{Handshake: st.checkOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// the stream outlives the server read and write timeouts
+		if err := ws.SetDeadline(time.Time{}); err != nil {
+			return
+		}
+
+		// the connection is closed before unsubscribing, as shutdown waits
+		// for the subscribers but doesn't track hijacked connections
+		missed, events, cancel := st.services.Stream.Subscribe(userID, lastEventID)
+		defer func() {
+			_ = ws.Close()
+			cancel()
+		}()
+
+		// the client doesn't send anything, reading only detects that it went away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var msg []byte
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+		}()
+
+		for _, event := range missed {
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			var err error
+			select {
+			case <-closed:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				err = websocket.JSON.Send(ws, event)
+			case <-heartbeat.C:
+				err = websocket.JSON.Send(ws, map[string]string{"type": "heartbeat"})
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
+
+// checkOrigin only lets pages of the API's own host or an allowed origin open
+// the WebSocket stream, as browsers send the stream token cookie along from
+// any site. Requests without an Origin don't come from a browser page.
+func (st *Stream) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil || origin == nil {
+		return err
+	}
+
+	if strings.EqualFold(origin.Host, r.Host) {
+		return nil
+	}
+
+	for _, allowed := range st.cfg.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin.Scheme+"://"+origin.Host) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+func writeSSEEvent(w http.ResponseWriter, event models.ItemEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+func getLastEventID(r *http.Request) (int64, error) {
+	raw := r.Header.Get(lastEventIDHeader)
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+
+	if raw == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.New("invalid last event id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream_SeesWritesWhosePublishFailed(t *testing.T) {
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	// a required broker that isn't connected fails every publish
+	routes, _, token := newTestRoutes(t, db, broker.NewPublisher(nil, false), Config{})
+	server := httptest.NewServer(routes)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+streamPath, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+
+	lines := bufio.NewScanner(stream.Body)
+	// the retry line is flushed once the stream is subscribed
+	require.True(t, lines.Scan())
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/items", strings.NewReader(`{"title":"streamed"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "event: ") {
+			require.Equal(t, "event: "+models.EventItemCreated, lines.Text())
+			return
+		}
+	}
+	t.Fatalf("stream ended without the event: %v", lines.Err())
+}
+
+func TestStream_WebSocketOrigin(t *testing.T) {
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	routes, _, token := newTestRoutes(t, db, broker.NewPublisher(nil, true),
+		Config{AllowedOrigins: []string{"https://app.example.com"}})
+	server := httptest.NewServer(routes)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{name: "no origin", origin: "", want: http.StatusSwitchingProtocols},
+		{name: "own host", origin: server.URL, want: http.StatusSwitchingProtocols},
+		{name: "allowed origin", origin: "https://app.example.com", want: http.StatusSwitchingProtocols},
+		{name: "other site", origin: "https://evil.example.com", want: http.StatusForbidden},
+		{name: "allowed host over another scheme", origin: "http://app.example.com", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+streamPath+"/ws", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.want, res.StatusCode)
+		})
+	}
+}
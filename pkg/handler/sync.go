@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"io"
+	"net/http"
+)
+
+type Sync struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewSync(services *service.Service, nats *broker.Publisher) *Sync {
+	return &Sync{services: services, nats: nats}
+}
+
+func (s *Sync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getChanges(w, r)
+	case http.MethodPost:
+		s.applyMutations(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// @Summary Get changes since a sync token
+// @Security ApiKeyAuth
+// @Tags sync
+// @Description get items created, modified or removed since the sync token; removed items are returned as tombstones
+// @ID sync-get-changes
+// @Accept  json
+// @Produce  json
+// @Param since query string false "sync token from the previous response"
+// @Success 200 {object} models.SyncChanges
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/sync [get]
+func (s *Sync) getChanges(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	changes, err := s.services.Sync.GetChanges(r.Context(), userID, r.URL.Query().Get("since"))
+	if err != nil {
+		newSyncErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, changes)
+}
+
+// @Summary Apply offline mutations
+// @Security ApiKeyAuth
+// @Tags sync
+// @Description apply a batch of offline mutations, resolving conflicts with last-writer-wins or version checks
+// @ID sync-apply-mutations
+// @Accept  json
+// @Produce  json
+// @Param input body models.SyncBatch true "mutations"
+// @Success 200 {array} models.SyncResult
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/sync [post]
+func (s *Sync) applyMutations(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.SyncBatch
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := s.services.Sync.Apply(r.Context(), userID, input)
+	if err != nil {
+		newSyncErrResponse(w, err)
+		return
+	}
+
+	for idx, result := range results {
+		if !result.Changed {
+			continue
+		}
+
+		switch input.Mutations[idx].Op {
+		case models.SyncOpCreate:
+			notifyItemEvent(r.Context(), s.services, userID, models.EventItemCreated, result.Item)
+		case models.SyncOpUpdate:
+			notifyItemEvent(r.Context(), s.services, userID, models.EventItemUpdated, result.Item)
+		case models.SyncOpDelete:
+			notifyItemEvent(r.Context(), s.services, userID, models.EventItemDeleted, map[string]interface{}{"id": result.ID})
+		}
+	}
+
+	newJSONResponse(w, http.StatusOK, results)
+}
+
+func newSyncErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSyncToken), errors.Is(err, service.ErrInvalidSyncStrategy):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSync_ReplayedMutationsAreNotAnnounced(t *testing.T) {
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	routes, services, token := newTestRoutes(t, db, broker.NewPublisher(nil, true), Config{})
+	identity, err := services.Authorization.ParseToken(context.Background(), token)
+	require.NoError(t, err)
+
+	_, events, unsubscribe := services.Stream.Subscribe(identity.UserID, 0)
+	defer unsubscribe()
+
+	apply := func(mutation string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(`{"mutations":[`+mutation+`]}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		routes.ServeHTTP(res, req)
+		require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		require.Contains(t, res.Body.String(), `"status":"applied"`)
+	}
+
+	// each mutation is sent twice, as by a client retrying after a lost response
+	create := `{"op":"create","client_id":"c1","title":"offline"}`
+	apply(create)
+	apply(create)
+	remove := `{"op":"delete","client_id":"c1"}`
+	apply(remove)
+	apply(remove)
+
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	require.Equal(t, []string{models.EventItemCreated, models.EventItemDeleted}, types)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracing_CreateItem(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := tracing.Install(exporter, tracing.Config{ServiceName: "todo-app-test", SampleRatio: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	db, err := repository.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, repository.InstrumentDB(db, "tracing_test"))
+
+	messages := make(chan fakeNATSMessage, 1)
+	conn, err := nats.Connect(fakeNATSServer(t, messages))
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+
+	routes, _, token := newTestRoutes(t, db, broker.NewPublisher(conn, false), Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/items", strings.NewReader(`{"title":"traced"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := httptest.NewRecorder()
+	routes.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+
+	var msg fakeNATSMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was published to nats")
+	}
+	require.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	find := func(name string) tracetest.SpanStub {
+		for _, span := range spans {
+			if span.Name == name {
+				return span
+			}
+		}
+		t.Fatalf("no %q span among %d", name, len(spans))
+		return tracetest.SpanStub{}
+	}
+
+	// HTTP -> service -> SQL all belong to one trace, each a child of the last
+	server := find("POST /api/items")
+	create := find("TodoItem.Create")
+	require.Equal(t, server.SpanContext.SpanID(), create.Parent.SpanID())
+	require.Equal(t, server.SpanContext.SpanID(), find("Authorization.ParseToken").Parent.SpanID())
+
+	var query *tracetest.SpanStub
+	for i, span := range spans {
+		if span.Parent.SpanID() == create.SpanContext.SpanID() && strings.HasPrefix(span.Name, "sqlite ") {
+			query = &spans[i]
+		}
+	}
+	require.NotNil(t, query, "TodoItem.Create ran no traced sql")
+	require.Equal(t, server.SpanContext.TraceID(), query.SpanContext.TraceID())
+
+	// the message carries the publish span so consumers continue the trace
+	publish := find("create_item publish")
+	require.Equal(t, server.SpanContext.SpanID(), publish.Parent.SpanID())
+	require.Equal(t, "create_item", msg.subject)
+	require.Equal(t, "00-"+publish.SpanContext.TraceID().String()+"-"+publish.SpanContext.SpanID().String()+"-01",
+		msg.header.Get("traceparent"))
+}
+
+type fakeNATSMessage struct {
+	subject string
+	header  nats.Header
+}
+
+// fakeNATSServer speaks just enough of the NATS protocol for a client to
+// connect and publish with headers, sending each message to messages. It
+// returns the URL to connect to.
+func fakeNATSServer(t *testing.T, messages chan<- fakeNATSMessage) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		port := listener.Addr().(*net.TCPAddr).Port
+		info, _ := json.Marshal(map[string]interface{}{
+			"server_id": "fake", "version": "2.10.0", "proto": 1, "headers": true,
+			"host": "127.0.0.1", "port": port, "max_payload": 1 << 20,
+		})
+		if _, err = io.WriteString(conn, "INFO "+string(info)+"\r\n"); err != nil {
+			return
+		}
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch strings.ToUpper(fields[0]) {
+			case "PING":
+				_, _ = io.WriteString(conn, "PONG\r\n")
+			case "HPUB":
+				// HPUB <subject> [reply-to] <header bytes> <total bytes>
+				headerSize, _ := strconv.Atoi(fields[len(fields)-2])
+				totalSize, _ := strconv.Atoi(fields[len(fields)-1])
+				payload := make([]byte, totalSize+2)
+				if _, err = io.ReadFull(reader, payload); err != nil {
+					return
+				}
+
+				header := nats.Header{}
+				for _, headerLine := range strings.Split(string(payload[:headerSize]), "\r\n")[1:] {
+					if key, value, ok := strings.Cut(headerLine, ":"); ok {
+						header[key] = append(header[key], strings.TrimSpace(value))
+					}
+				}
+				messages <- fakeNATSMessage{subject: fields[1], header: header}
+			}
+		}
+	}()
+
+	return "nats://" + listener.Addr().String()
+}
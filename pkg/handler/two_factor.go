@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"io"
+	"net/http"
+)
+
+type TwoFactor struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewTwoFactor(services *service.Service, nats *broker.Publisher) *TwoFactor {
+	return &TwoFactor{services: services, nats: nats}
+}
+
+// @Summary Start 2FA enrollment
+// @Security ApiKeyAuth
+// @Tags 2fa
+// @Description generate a TOTP secret and the otpauth:// URI to show as a QR code; 2FA is enabled once confirmed with a code
+// @ID two-factor-enroll
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.TwoFactorEnrollment
+// @Failure 400,404 {object} errorResponse
+// @Failure 409 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/2fa/enroll [post]
+func (t *TwoFactor) enroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	enrollment, err := t.services.TwoFactor.Enroll(r.Context(), userID)
+	if err != nil {
+		newTwoFactorErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, enrollment)
+}
+
+// @Summary Confirm 2FA enrollment
+// @Security ApiKeyAuth
+// @Tags 2fa
+// @Description enable 2FA with a code from the authenticator; the one-time recovery codes are only returned here
+// @ID two-factor-confirm
+// @Accept  json
+// @Produce  json
+// @Param input body models.TwoFactorCodeInput true "code from the authenticator app"
+// @Success 200 {object} models.RecoveryCodes
+// @Failure 400,404 {object} errorResponse
+// @Failure 409 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/2fa/confirm [post]
+func (t *TwoFactor) confirm(w http.ResponseWriter, r *http.Request) {
+	userID, input, ok := t.readCodeInput(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := t.services.TwoFactor.Confirm(r.Context(), userID, input.Code)
+	if err != nil {
+		newTwoFactorErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, models.RecoveryCodes{Codes: codes})
+}
+
+// @Summary Disable 2FA
+// @Security ApiKeyAuth
+// @Tags 2fa
+// @Description turn 2FA off; requires a current code or a recovery code
+// @ID two-factor-disable
+// @Accept  json
+// @Produce  json
+// @Param input body models.TwoFactorCodeInput true "code from the authenticator app or a recovery code"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/2fa/disable [post]
+func (t *TwoFactor) disable(w http.ResponseWriter, r *http.Request) {
+	userID, input, ok := t.readCodeInput(w, r)
+	if !ok {
+		return
+	}
+
+	if err := t.services.TwoFactor.Disable(r.Context(), userID, input.Code); err != nil {
+		newTwoFactorErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+func (t *TwoFactor) readCodeInput(w http.ResponseWriter, r *http.Request) (int, models.TwoFactorCodeInput, bool) {
+	var input models.TwoFactorCodeInput
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return 0, input, false
+	}
+
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return 0, input, false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return 0, input, false
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return 0, input, false
+	}
+
+	if input.Code == "" {
+		newErrResponse(w, http.StatusBadRequest, "code is required")
+		return 0, input, false
+	}
+
+	return userID, input, true
+}
+
+func newTwoFactorErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		newErrResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
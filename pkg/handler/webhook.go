@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	broker "github.com/NekruzRakhimov/todo_app/nats"
+	"github.com/NekruzRakhimov/todo_app/pkg/service"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+const (
+	webhookPath           = "^/api/webhooks/([0-9]+)$"
+	webhookDeliveriesPath = "^/api/webhooks/([0-9]+)/deliveries$"
+	webhookDeliveryPath   = "^/api/webhooks/([0-9]+)/deliveries/([0-9]+)$"
+	webhookRedeliverPath  = "^/api/webhooks/([0-9]+)/deliveries/([0-9]+)/redeliver$"
+)
+
+var (
+	webhookRe           = regexp.MustCompile(webhookPath)
+	webhookDeliveriesRe = regexp.MustCompile(webhookDeliveriesPath)
+	webhookDeliveryRe   = regexp.MustCompile(webhookDeliveryPath)
+	webhookRedeliverRe  = regexp.MustCompile(webhookRedeliverPath)
+)
+
+type Webhook struct {
+	services *service.Service
+	nats     *broker.Publisher
+}
+
+func NewWebhook(services *service.Service, nats *broker.Publisher) *Webhook {
+	return &Webhook{services: services, nats: nats}
+}
+
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/api/webhooks" || path == "/api/webhooks/":
+		switch r.Method {
+		case http.MethodGet:
+			wh.getAllWebhooks(w, r)
+		case http.MethodPost:
+			wh.createWebhook(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case webhookRe.MatchString(path):
+		switch r.Method {
+		case http.MethodGet:
+			wh.getWebhookByID(w, r)
+		case http.MethodDelete:
+			wh.deleteWebhook(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case webhookDeliveriesRe.MatchString(path) && r.Method == http.MethodGet:
+		wh.getDeliveries(w, r)
+	case webhookDeliveryRe.MatchString(path) && r.Method == http.MethodGet:
+		wh.getDeliveryByID(w, r)
+	case webhookRedeliverRe.MatchString(path) && r.Method == http.MethodPost:
+		wh.redeliver(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// @Summary Create webhook
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description register a callback URL for item events; the signing secret is returned only once
+// @ID create-webhook
+// @Accept  json
+// @Produce  json
+// @Param input body models.WebhookInput true "webhook info"
+// @Success 201 {object} models.Webhook
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks [post]
+func (wh *Webhook) createWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input models.WebhookInput
+	if err = json.Unmarshal(body, &input); err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhook, err := wh.services.Webhook.Create(r.Context(), userID, input)
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusCreated, webhook)
+}
+
+// @Summary Get all webhooks
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description get all webhooks
+// @ID get-all-webhooks
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Webhook
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks [get]
+func (wh *Webhook) getAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhooks, err := wh.services.Webhook.GetAll(r.Context(), userID)
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, webhooks)
+}
+
+// @Summary Get webhook by ID
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description get webhook by ID
+// @ID get-webhook-by-id
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "webhook id"
+// @Success 200 {object} models.Webhook
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks/{id} [get]
+func (wh *Webhook) getWebhookByID(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhookID, err := getPathParam(webhookPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhook, err := wh.services.Webhook.GetByID(r.Context(), userID, webhookID)
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, webhook)
+}
+
+// @Summary Delete webhook
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description delete webhook
+// @ID delete-webhook
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "webhook id"
+// @Success 200 {object} statusResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks/{id} [delete]
+func (wh *Webhook) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhookID, err := getPathParam(webhookPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = wh.services.Webhook.Delete(r.Context(), userID, webhookID); err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newStatusResponse(w, "ok")
+}
+
+// @Summary Get webhook deliveries
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description get the delivery log of a webhook
+// @ID get-webhook-deliveries
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "webhook id"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks/{id}/deliveries [get]
+func (wh *Webhook) getDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhookID, err := getPathParam(webhookDeliveriesPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deliveries, err := wh.services.Webhook.GetDeliveries(r.Context(), userID, webhookID)
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, deliveries)
+}
+
+// @Summary Get webhook delivery
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description get a single webhook delivery
+// @ID get-webhook-delivery
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "webhook id"
+// @Param delivery_id path integer true "delivery id"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks/{id}/deliveries/{delivery_id} [get]
+func (wh *Webhook) getDeliveryByID(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params, err := getPathParams(webhookDeliveryPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	delivery, err := wh.services.Webhook.GetDeliveryByID(r.Context(), userID, params[0], params[1])
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusOK, delivery)
+}
+
+// @Summary Redeliver webhook delivery
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Description send the payload of a delivery again
+// @ID redeliver-webhook-delivery
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "webhook id"
+// @Param delivery_id path integer true "delivery id"
+// @Success 202 {object} dataResponse
+// @Failure 400,404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Failure default {object} errorResponse
+// @Router /api/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (wh *Webhook) redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, err := getRequestUserId(r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params, err := getPathParams(webhookRedeliverPath, r)
+	if err != nil {
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deliveryID, err := wh.services.Webhook.Redeliver(r.Context(), userID, params[0], params[1])
+	if err != nil {
+		newWebhookErrResponse(w, err)
+		return
+	}
+
+	newJSONResponse(w, http.StatusAccepted, dataResponse{Data: map[string]interface{}{"delivery_id": deliveryID}})
+}
+
+func newWebhookErrResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrInvalidWebhookEvent),
+		errors.Is(err, service.ErrWebhookAddressForbidden):
+		newErrResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		newErrResponse(w, http.StatusNotFound, "webhook not found")
+	default:
+		newErrResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,164 @@
+// Package health tracks whether the app's dependencies are reachable, for the
+// readiness probe.
+package health
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Version is the release the binary was built from, set with
+// -ldflags "-X github.com/NekruzRakhimov/todo_app/pkg/health.Version=v1.2.3".
+var Version = "dev"
+
+// Check reports why a dependency is unusable, or nil.
+type Check func(ctx context.Context) error
+
+type check struct {
+	name     string
+	run      Check
+	optional bool
+}
+
+// Checker runs the registered checks. It reports not ready once shutdown has
+// started, so the orchestrator stops routing traffic before the server exits.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker giving each check up to timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check the app can't serve without.
+func (c *Checker) Add(name string, run Check) {
+	c.add(check{name: name, run: run})
+}
+
+// AddOptional registers a check that is reported but doesn't make the app
+// unready, e.g. a broker the app can run without.
+func (c *Checker) AddOptional(name string, run Check) {
+	c.add(check{name: name, run: run, optional: true})
+}
+
+func (c *Checker) add(ch check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, ch)
+}
+
+// ShutDown marks the app as shutting down; readiness fails from then on.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+type Result struct {
+	Status   string `json:"status"`
+	Optional bool   `json:"optional,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the app is ready, running all checks concurrently.
+func (c *Checker) Ready(ctx context.Context) (Report, bool) {
+	c.mu.RLock()
+	checks := make([]check, len(c.checks))
+	copy(checks, c.checks)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status == StatusDown && !ch.optional {
+			report.Status = StatusDown
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = StatusDown
+		report.Error = ErrShuttingDown.Error()
+	}
+
+	return report, report.Status == StatusUp
+}
+
+func runCheck(ctx context.Context, ch check) Result {
+	start := time.Now()
+	err := ch.run(ctx)
+	result := Result{Status: StatusUp, Optional: ch.optional, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Build describes the running binary, taking the VCS details the Go
+// toolchain stamps into it.
+func Build() BuildInfo {
+	info := BuildInfo{Version: Version}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = bi.GoVersion
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
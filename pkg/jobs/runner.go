@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull = errors.New("job queue is full")
+	ErrStopped   = errors.New("job runner is stopped")
+)
+
+type job struct {
+	name string
+	run  func() error
+}
+
+// Runner runs background jobs on a fixed number of workers. Jobs live only
+// in memory, so the ones still queued are lost if the process exits.
+type Runner struct {
+	queue chan job
+	wg    sync.WaitGroup
+	// stop is closed on Shutdown and ends the schedules started by Every.
+	stop chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func NewRunner(workers, queueSize int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+
+	r := &Runner{queue: make(chan job, queueSize), stop: make(chan struct{})}
+	for i := 0; i < workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+
+	return r
+}
+
+// Enqueue schedules run without waiting. It fails instead of blocking when
+// the queue is full.
+func (r *Runner) Enqueue(name string, run func() error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.stopped {
+		return ErrStopped
+	}
+
+	select {
+	case r.queue <- job{name: name, run: run}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Every enqueues run right away and then every interval until Shutdown. A
+// tick is skipped while the previous run is still queued or running. run gets
+// a background context; Shutdown waits for it rather than cancelling it.
+func (r *Runner) Every(name string, interval time.Duration, run func(ctx context.Context) error) {
+	var busy atomic.Bool
+	schedule := func() {
+		if !busy.CompareAndSwap(false, true) {
+			return
+		}
+		err := r.Enqueue(name, func() error {
+			defer busy.Store(false)
+			return run(context.Background())
+		})
+		if err != nil {
+			busy.Store(false)
+			if !errors.Is(err, ErrStopped) {
+				logrus.Warnf("couldn't schedule job %s: %s", name, err.Error())
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		schedule()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				schedule()
+			}
+		}
+	}()
+}
+
+// Shutdown stops accepting jobs and waits for the queued ones to finish or
+// for ctx to be done.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) work() {
+	defer r.wg.Done()
+
+	for j := range r.queue {
+		r.run(j)
+	}
+}
+
+func (r *Runner) run(j job) {
+	defer func() {
+		if p := recover(); p != nil {
+			logrus.Errorf("job %s panicked: %v", j.name, p)
+		}
+	}()
+
+	if err := j.run(); err != nil {
+		logrus.Errorf("job %s failed: %s", j.name, err.Error())
+	}
+}
@@ -0,0 +1,348 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockID is the key of the advisory lock held while migrating, so only one
+// instance migrates at a time.
+const lockID = 7_311_542_001
+
+var fileRe = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("database is dirty")
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version uint
+	Dirty   bool
+	// Applied has one entry per known migration.
+	Applied map[uint]bool
+}
+
+// Migrator applies numbered up/down SQL files. The current version is kept
+// in schema_migrations in the same layout golang-migrate uses, so databases
+// migrated with that tool carry on where they were.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Latest is the version of the newest migration.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the newest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		version, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if version == 0 {
+			return nil
+		}
+
+		return m.migrate(ctx, conn, version, m.previous(version))
+	})
+}
+
+// To migrates up or down until version is the current one.
+func (m *Migrator) To(ctx context.Context, version uint) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+// Force sets the version without running anything, e.g. to adopt a database
+// whose schema was applied by hand or to clear the dirty flag.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err = setVersion(ctx, tx, version, false); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status reads the version without taking the lock, so it answers while a
+// migration is running; the version then shows as dirty.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+
+	var table sql.NullString
+	if err := m.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations')::text`).Scan(&table); err != nil {
+		return Status{}, err
+	}
+	if table.Valid {
+		err := m.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).
+			Scan(&status.Version, &status.Dirty)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Status{}, err
+		}
+	}
+
+	status.Applied = make(map[uint]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		status.Applied[migration.Version] = migration.Version <= status.Version
+	}
+
+	return status, nil
+}
+
+// migrate runs the migrations between from and to, each in its own
+// transaction together with the version update. Before each one the target
+// version is recorded as dirty in a separate commit; the migration's
+// transaction clears the flag, so it stays set only if the process died or
+// the migration failed midway, and later runs refuse to go on until the
+// version is forced.
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, from, to uint) error {
+	for from < to {
+		next := m.migrations[m.find(from)+1]
+		if err := m.apply(ctx, conn, next.Up, next.Version); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", next.Version, next.Name, err)
+		}
+		from = next.Version
+	}
+
+	for from > to {
+		i := m.find(from)
+		if i < 0 {
+			return fmt.Errorf("database is at version %d, which has no migration here", from)
+		}
+
+		prev := m.previous(from)
+		if err := m.apply(ctx, conn, m.migrations[i].Down, prev); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", from, m.migrations[i].Name, err)
+		}
+		from = prev
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query string, version uint) error {
+	if err := markDirty(ctx, conn, version); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if err = setVersion(ctx, tx, version, false); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// current returns the applied version, refusing to go on if a previous run
+// left the database dirty.
+func (m *Migrator) current(ctx context.Context, conn *sql.Conn) (uint, error) {
+	var version uint
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d, fix the schema and force the version", ErrDirty, version)
+	}
+
+	return version, nil
+}
+
+// withLock runs fn on a single connection holding the advisory lock, after
+// making sure the version table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version bigint  not null primary key,
+			dirty   boolean not null
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func markDirty(ctx context.Context, conn *sql.Conn, version uint) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, true)`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setVersion(ctx context.Context, tx *sql.Tx, version uint, dirty bool) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	if version == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+	return err
+}
+
+// find returns the index of the migration with version, or -1. Version 0,
+// the empty database, is just before the first one.
+func (m *Migrator) find(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *Migrator) previous(version uint) uint {
+	i := m.find(version)
+	if i <= 0 {
+		return 0
+	}
+
+	return m.migrations[i-1].Version
+}
+
+func load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		match := fileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
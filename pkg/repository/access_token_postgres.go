@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"time"
+)
+
+type AccessTokenPostgres struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenPostgres(db *gorm.DB) *AccessTokenPostgres {
+	return &AccessTokenPostgres{db: db}
+}
+
+type accessTokenRow struct {
+	ID          int
+	UserID      int
+	Name        string
+	TokenPrefix string
+	Scopes      pq.StringArray
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+func (t accessTokenRow) toModel() models.PersonalAccessToken {
+	return models.PersonalAccessToken{
+		ID:         t.ID,
+		UserID:     t.UserID,
+		Name:       t.Name,
+		Prefix:     t.TokenPrefix,
+		Scopes:     t.Scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func (r *AccessTokenPostgres) Create(ctx context.Context, token models.PersonalAccessToken, tokenHash string,
+	ttl time.Duration) (models.PersonalAccessToken, error) {
+	sqlQuery := `INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at)
+					VALUES (?, ?, ?, ?, ?, CASE WHEN ? > 0 THEN now() + make_interval(secs => ?) END)
+					RETURNING id, user_id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+	var row accessTokenRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, token.UserID, token.Name, token.Prefix, tokenHash, pq.Array(token.Scopes),
+		ttl.Seconds(), ttl.Seconds()).Scan(&row).Error; err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	return row.toModel(), nil
+}
+
+func (r *AccessTokenPostgres) GetAll(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	sqlQuery := `SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+					FROM personal_access_tokens
+					WHERE user_id = ?
+					ORDER BY id`
+	var rows []accessTokenRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	tokens := make([]models.PersonalAccessToken, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, row.toModel())
+	}
+
+	return tokens, nil
+}
+
+func (r *AccessTokenPostgres) GetActiveByHash(ctx context.Context, tokenHash string) (models.PersonalAccessToken, error) {
+	sqlQuery := `SELECT t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.revoked_at,
+					       t.created_at
+					FROM personal_access_tokens t
+					         INNER JOIN users u ON t.user_id = u.id
+					WHERE t.token_hash = ?
+					  AND t.revoked_at IS NULL
+					  AND (t.expires_at IS NULL OR t.expires_at > now())
+					  AND u.disabled_at IS NULL`
+	var row accessTokenRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, tokenHash).Scan(&row).Error; err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	if row.ID == 0 {
+		return models.PersonalAccessToken{}, gorm.ErrRecordNotFound
+	}
+
+	return row.toModel(), nil
+}
+
+func (r *AccessTokenPostgres) Revoke(ctx context.Context, userID, tokenID int) error {
+	sqlQuery := `UPDATE personal_access_tokens
+					SET revoked_at = now()
+					WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+	result := r.db.WithContext(ctx).Exec(sqlQuery, tokenID, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *AccessTokenPostgres) Touch(ctx context.Context, tokenID int, interval time.Duration) error {
+	sqlQuery := `UPDATE personal_access_tokens
+					SET last_used_at = now()
+					WHERE id = ?
+					  AND (last_used_at IS NULL OR last_used_at < now() - make_interval(secs => ?))`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, tokenID, interval.Seconds()).Error
+	return err
+}
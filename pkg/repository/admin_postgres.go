@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type AdminPostgres struct {
+	db *gorm.DB
+}
+
+func NewAdminPostgres(db *gorm.DB) *AdminPostgres {
+	return &AdminPostgres{db: db}
+}
+
+const adminUserColumns = `u.id, u.name, u.username, COALESCE(u.email, '') AS email, u.email_verified, u.role,
+					       u.totp_enabled AS two_factor_enabled, u.disabled_at,
+					       (SELECT count(*) FROM todo_items ti WHERE ti.user_id = u.id AND ti.is_removed = false) AS item_count,
+					       (SELECT count(*) FROM todo_items ti
+					        WHERE ti.user_id = u.id AND ti.is_removed = false AND ti.done = true) AS done_item_count`
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *AdminPostgres) ListUsers(ctx context.Context, search string, limit, offset int) (users []models.AdminUser, total int, err error) {
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+	filter := `? = '' OR u.username ILIKE ? OR u.name ILIKE ? OR u.email ILIKE ?`
+
+	countQuery := `SELECT count(*) FROM users u WHERE ` + filter
+	if err = r.db.WithContext(ctx).Raw(countQuery, search, pattern, pattern, pattern).Scan(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	sqlQuery := `SELECT ` + adminUserColumns + `
+					FROM users u
+					WHERE ` + filter + `
+					ORDER BY u.id
+					LIMIT ? OFFSET ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, search, pattern, pattern, pattern, limit, offset).Scan(&users).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (r *AdminPostgres) GetUser(ctx context.Context, userID int) (user models.AdminUser, err error) {
+	sqlQuery := `SELECT ` + adminUserColumns + `
+					FROM users u
+					WHERE u.id = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&user).Error; err != nil {
+		return models.AdminUser{}, err
+	}
+
+	if user.ID == 0 {
+		return models.AdminUser{}, gorm.ErrRecordNotFound
+	}
+
+	return user, nil
+}
+
+func (r *AdminPostgres) SetDisabled(ctx context.Context, userID int, disabled bool) error {
+	sqlQuery := `UPDATE users
+					SET disabled_at = CASE WHEN ? THEN COALESCE(disabled_at, now()) END
+					WHERE id = ?`
+	result := r.db.WithContext(ctx).Exec(sqlQuery, disabled, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *AdminPostgres) DeleteUser(ctx context.Context, userID int) error {
+	result := r.db.WithContext(ctx).Exec(`DELETE FROM users WHERE id = ?`, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/sirupsen/logrus"
+)
+
+// AuthAuditLogger writes audit entries to the application log, for backends
+// without an auth_audit_log table.
+type AuthAuditLogger struct{}
+
+func NewAuthAuditLogger() *AuthAuditLogger {
+	return &AuthAuditLogger{}
+}
+
+func (r *AuthAuditLogger) Log(ctx context.Context, entry models.AuthAuditEntry) error {
+	fields := logrus.Fields{"event": entry.Event, "username": entry.Username, "ip": entry.IP}
+	if entry.UserID != nil {
+		fields["user_id"] = *entry.UserID
+	}
+	if entry.ActorID != nil {
+		fields["actor_id"] = *entry.ActorID
+	}
+	if entry.Details != "" {
+		fields["details"] = entry.Details
+	}
+
+	logrus.WithFields(fields).Info("auth audit")
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+)
+
+type AuthAuditPostgres struct {
+	db *gorm.DB
+}
+
+func NewAuthAuditPostgres(db *gorm.DB) *AuthAuditPostgres {
+	return &AuthAuditPostgres{db: db}
+}
+
+func (r *AuthAuditPostgres) Log(ctx context.Context, entry models.AuthAuditEntry) error {
+	sqlQuery := `INSERT INTO auth_audit_log (user_id, actor_id, username, ip, event, details)
+					VALUES (?, ?, ?, ?, ?, ?)`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, entry.UserID, entry.ActorID, entry.Username, entry.IP, entry.Event, entry.Details).Error
+	return err
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"strings"
+	"sync"
+)
+
+type memoryUser struct {
+	user         models.User
+	passwordHash string
+}
+
+// AuthMemory keeps users in process memory, for tests and demos. Everything
+// is lost on restart.
+type AuthMemory struct {
+	mu     sync.RWMutex
+	users  map[int]*memoryUser
+	nextID int
+}
+
+func NewAuthMemory() *AuthMemory {
+	return &AuthMemory{users: make(map[int]*memoryUser)}
+}
+
+func (r *AuthMemory) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[int]*memoryUser, len(r.users))
+	for id, u := range r.users {
+		copied := *u
+		users[id] = &copied
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.users = users
+	}
+}
+
+func (r *AuthMemory) CreateUser(ctx context.Context, user models.User) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if strings.EqualFold(u.user.Username, user.Username) {
+			return 0, ErrUsernameTaken
+		}
+		if user.Email != "" && strings.EqualFold(u.user.Email, user.Email) {
+			return 0, ErrEmailTaken
+		}
+	}
+
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	hash := user.Password
+	user.Password = ""
+	r.users[user.ID] = &memoryUser{user: user, passwordHash: hash}
+
+	return user.ID, nil
+}
+
+func (r *AuthMemory) GetUser(ctx context.Context, username, password string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u := r.findByUsername(username)
+	if u == nil || u.passwordHash != password {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u.user, nil
+}
+
+func (r *AuthMemory) UsernameExists(ctx context.Context, username string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.findByUsername(username) != nil, nil
+}
+
+func (r *AuthMemory) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u := r.findByUsername(username)
+	if u == nil {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u.user, nil
+}
+
+func (r *AuthMemory) GetUserByID(ctx context.Context, userID int) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[userID]
+	if !ok {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u.user, nil
+}
+
+func (r *AuthMemory) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.user.Email != "" && strings.EqualFold(u.user.Email, email) {
+			return u.user, nil
+		}
+	}
+
+	return models.User{}, gorm.ErrRecordNotFound
+}
+
+func (r *AuthMemory) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.users[userID]; ok {
+		u.passwordHash = passwordHash
+	}
+
+	return nil
+}
+
+// SetEmailVerified is a no-op; models.User doesn't carry the flag.
+func (r *AuthMemory) SetEmailVerified(ctx context.Context, userID int) error {
+	return nil
+}
+
+func (r *AuthMemory) findByUsername(username string) *memoryUser {
+	for _, u := range r.users {
+		if strings.EqualFold(u.user.Username, username) {
+			return u
+		}
+	}
+
+	return nil
+}
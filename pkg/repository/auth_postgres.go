@@ -1,11 +1,21 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+const uniqueViolation = "23505"
+
+var (
+	ErrUsernameTaken = errors.New("username is already taken")
+	ErrEmailTaken    = errors.New("email is already registered")
+)
+
 type AuthPostgres struct {
 	db *gorm.DB
 }
@@ -14,22 +24,71 @@ func NewAuthPostgres(db *gorm.DB) *AuthPostgres {
 	return &AuthPostgres{db: db}
 }
 
-func (r *AuthPostgres) CreateUser(user models.User) (id int, err error) {
+func (r *AuthPostgres) CreateUser(ctx context.Context, user models.User) (id int, err error) {
 	sqlQuery := fmt.Sprintf(
-		`INSERT INTO %s (name, username, password_hash) VALUES($1, $2, $3) RETURNING id`, usersTable)
-	if err = r.db.Table(usersTable).
-		Exec(sqlQuery, user.Name, user.Username, user.Password).
-		Pluck("id", &id).Error; err != nil {
+		`INSERT INTO %s (name, username, password_hash, email, role)
+				VALUES($1, $2, $3, NULLIF($4, ''), COALESCE(NULLIF($5, ''), 'user')) RETURNING id`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, user.Name, user.Username, user.Password, user.Email, user.Role).
+		Scan(&id).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			switch pgErr.ConstraintName {
+			case "users_username_idx":
+				return 0, ErrUsernameTaken
+			case "users_email_idx":
+				return 0, ErrEmailTaken
+			}
+		}
 		return 0, err
 	}
 
 	return id, nil
 }
 
-func (r *AuthPostgres) GetUser(username, password string) (u models.User, err error) {
+func (r *AuthPostgres) UsernameExists(ctx context.Context, username string) (exists bool, err error) {
+	sqlQuery := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE lower(username) = lower($1))`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, username).Scan(&exists).Error; err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *AuthPostgres) GetUser(ctx context.Context, username, password string) (u models.User, err error) {
+	sqlQuery := fmt.Sprintf(
+		`SELECT id, name, username, COALESCE(email, '') AS email, role,
+				disabled_at IS NOT NULL AS disabled FROM %s WHERE lower(username) = lower($1) AND password_hash = $2 `, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, username, password).Scan(&u).Error; err != nil {
+		return models.User{}, err
+	}
+
+	if u.ID == 0 {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u, nil
+}
+
+func (r *AuthPostgres) GetUserByID(ctx context.Context, userID int) (u models.User, err error) {
+	sqlQuery := fmt.Sprintf(
+		`SELECT id, name, username, COALESCE(email, '') AS email, role,
+				disabled_at IS NOT NULL AS disabled FROM %s WHERE id = $1`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&u).Error; err != nil {
+		return models.User{}, err
+	}
+
+	if u.ID == 0 {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u, nil
+}
+
+func (r *AuthPostgres) GetUserByUsername(ctx context.Context, username string) (u models.User, err error) {
 	sqlQuery := fmt.Sprintf(
-		`SELECT id, name, username FROM %s WHERE username = $1 AND password_hash = $2 `, usersTable)
-	if err = r.db.Raw(sqlQuery, username, password).Scan(&u).Error; err != nil {
+		`SELECT id, name, username, COALESCE(email, '') AS email, role,
+				disabled_at IS NOT NULL AS disabled FROM %s WHERE lower(username) = lower($1)`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, username).Scan(&u).Error; err != nil {
 		return models.User{}, err
 	}
 
@@ -39,3 +98,32 @@ func (r *AuthPostgres) GetUser(username, password string) (u models.User, err er
 
 	return u, nil
 }
+
+func (r *AuthPostgres) GetUserByEmail(ctx context.Context, email string) (u models.User, err error) {
+	sqlQuery := fmt.Sprintf(
+		`SELECT id, name, username, COALESCE(email, '') AS email, role,
+				disabled_at IS NOT NULL AS disabled FROM %s WHERE lower(email) = lower($1)`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, email).Scan(&u).Error; err != nil {
+		return models.User{}, err
+	}
+
+	if u.ID == 0 {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u, nil
+}
+
+func (r *AuthPostgres) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	sqlQuery := fmt.Sprintf(`UPDATE %s SET password_hash = $1 WHERE id = $2`, usersTable)
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, passwordHash, userID).Error
+	return err
+}
+
+func (r *AuthPostgres) SetEmailVerified(ctx context.Context, userID int) error {
+	sqlQuery := fmt.Sprintf(`UPDATE %s SET email_verified = true WHERE id = $1`, usersTable)
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, userID).Error
+	return err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+)
+
+const sqliteUserColumns = `id, name, username, COALESCE(email, '') AS email, role, disabled_at IS NOT NULL AS disabled`
+
+type AuthSQLite struct {
+	db *gorm.DB
+}
+
+func NewAuthSQLite(db *gorm.DB) *AuthSQLite {
+	return &AuthSQLite{db: db}
+}
+
+func (r *AuthSQLite) CreateUser(ctx context.Context, user models.User) (id int, err error) {
+	sqlQuery := `INSERT INTO users (name, username, password_hash, email, role)
+					VALUES (?, ?, ?, NULLIF(?, ''), COALESCE(NULLIF(?, ''), 'user')) RETURNING id`
+	err = r.db.WithContext(ctx).Raw(sqlQuery, user.Name, user.Username, user.Password, user.Email, user.Role).Scan(&id).Error
+	switch {
+	case isSQLiteUniqueViolation(err, "users_username_idx"):
+		return 0, ErrUsernameTaken
+	case isSQLiteUniqueViolation(err, "users_email_idx"):
+		return 0, ErrEmailTaken
+	case err != nil:
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *AuthSQLite) UsernameExists(ctx context.Context, username string) (exists bool, err error) {
+	sqlQuery := `SELECT EXISTS(SELECT 1 FROM users WHERE lower(username) = lower(?))`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, username).Scan(&exists).Error; err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *AuthSQLite) GetUser(ctx context.Context, username, password string) (models.User, error) {
+	return r.getUser(ctx, `lower(username) = lower(?) AND password_hash = ?`, username, password)
+}
+
+func (r *AuthSQLite) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	return r.getUser(ctx, `lower(username) = lower(?)`, username)
+}
+
+func (r *AuthSQLite) GetUserByID(ctx context.Context, userID int) (models.User, error) {
+	return r.getUser(ctx, `id = ?`, userID)
+}
+
+func (r *AuthSQLite) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.getUser(ctx, `lower(email) = lower(?)`, email)
+}
+
+func (r *AuthSQLite) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	err := r.db.WithContext(ctx).Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID).Error
+	return err
+}
+
+func (r *AuthSQLite) SetEmailVerified(ctx context.Context, userID int) error {
+	err := r.db.WithContext(ctx).Exec(`UPDATE users SET email_verified = true WHERE id = ?`, userID).Error
+	return err
+}
+
+func (r *AuthSQLite) getUser(ctx context.Context, where string, args ...interface{}) (u models.User, err error) {
+	sqlQuery := `SELECT ` + sqliteUserColumns + ` FROM users WHERE ` + where
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, args...).Scan(&u).Error; err != nil {
+		return models.User{}, err
+	}
+
+	if u.ID == 0 {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return u, nil
+}
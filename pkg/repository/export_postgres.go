@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ExportPostgres struct {
+	db *gorm.DB
+}
+
+func NewExportPostgres(db *gorm.DB) *ExportPostgres {
+	return &ExportPostgres{db: db}
+}
+
+const exportColumns = `id, COALESCE(user_id, 0) AS user_id, status, file_key, error, created_at, completed_at, expires_at`
+
+func (r *ExportPostgres) Create(ctx context.Context, userID int) (export models.DataExport, err error) {
+	sqlQuery := `INSERT INTO data_exports (user_id) VALUES (?) RETURNING ` + exportColumns
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&export).Error; err != nil {
+		return models.DataExport{}, err
+	}
+
+	return export, nil
+}
+
+func (r *ExportPostgres) GetByID(ctx context.Context, exportID int) (export models.DataExport, err error) {
+	sqlQuery := `SELECT ` + exportColumns + ` FROM data_exports WHERE id = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, exportID).Scan(&export).Error; err != nil {
+		return models.DataExport{}, err
+	}
+
+	if export.ID == 0 {
+		return models.DataExport{}, gorm.ErrRecordNotFound
+	}
+
+	return export, nil
+}
+
+func (r *ExportPostgres) GetAll(ctx context.Context, userID int) (exports []models.DataExport, err error) {
+	sqlQuery := `SELECT ` + exportColumns + ` FROM data_exports WHERE user_id = ? ORDER BY id DESC`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&exports).Error; err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (r *ExportPostgres) GetPending(ctx context.Context, userID int, since time.Duration) (export models.DataExport, err error) {
+	sqlQuery := `SELECT ` + exportColumns + `
+					FROM data_exports
+					WHERE user_id = ?
+					  AND status = ?
+					  AND created_at > now() - make_interval(secs => ?)
+					ORDER BY id DESC
+					LIMIT 1`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, models.ExportPending, since.Seconds()).Scan(&export).Error; err != nil {
+		return models.DataExport{}, err
+	}
+
+	if export.ID == 0 {
+		return models.DataExport{}, gorm.ErrRecordNotFound
+	}
+
+	return export, nil
+}
+
+func (r *ExportPostgres) MarkReady(ctx context.Context, exportID int, fileKey string, ttl time.Duration) error {
+	sqlQuery := `UPDATE data_exports
+					SET status       = ?,
+					    file_key     = ?,
+					    completed_at = now(),
+					    expires_at   = now() + make_interval(secs => ?)
+					WHERE id = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, models.ExportReady, fileKey, ttl.Seconds(), exportID).Error
+	return err
+}
+
+func (r *ExportPostgres) MarkFailed(ctx context.Context, exportID int, message string) error {
+	sqlQuery := `UPDATE data_exports SET status = ?, error = ?, completed_at = now() WHERE id = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, models.ExportFailed, message, exportID).Error
+	return err
+}
+
+func (r *ExportPostgres) GetExpired(ctx context.Context) (exports []models.DataExport, err error) {
+	sqlQuery := `SELECT ` + exportColumns + ` FROM data_exports WHERE expires_at <= now()`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery).Scan(&exports).Error; err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (r *ExportPostgres) Delete(ctx context.Context, exportID int) error {
+	err := r.db.WithContext(ctx).Exec(`DELETE FROM data_exports WHERE id = ?`, exportID).Error
+	return err
+}
+
+func (r *ExportPostgres) GetItems(ctx context.Context, userID int) (items []models.ExportItem, err error) {
+	sqlQuery := `SELECT id, COALESCE(client_id, '') AS client_id, title, COALESCE(description, '') AS description,
+					       done, is_removed, version, created_at, updated_at
+					FROM todo_items
+					WHERE user_id = ?
+					ORDER BY id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *ExportPostgres) GetAuthHistory(ctx context.Context, userID int) (entries []models.AuthAuditEntry, err error) {
+	sqlQuery := `SELECT id, user_id, actor_id, username, ip, event, details, created_at
+					FROM auth_audit_log
+					WHERE user_id = ?
+					ORDER BY id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+// IdempotencyMemory keeps idempotency records in process memory. It suits a
+// single instance; use IdempotencyPostgres when running several.
+type IdempotencyMemory struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]models.IdempotencyRecord
+}
+
+func NewIdempotencyMemory() *IdempotencyMemory {
+	return &IdempotencyMemory{records: make(map[idempotencyKey]models.IdempotencyRecord)}
+}
+
+func (r *IdempotencyMemory) Reserve(ctx context.Context, record models.IdempotencyRecord, ttl,
+	lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if existing, ok := r.records[k]; ok && now.Before(existing.ExpiresAt) {
+		abandoned := !existing.Completed && existing.RequestHash == record.RequestHash &&
+			now.After(existing.LockedUntil)
+		if !abandoned {
+			return existing, false, nil
+		}
+	}
+
+	record.Completed = false
+	record.ExpiresAt = now.Add(ttl)
+	record.LockedUntil = now.Add(lease)
+	r.records[k] = record
+
+	return record, true, nil
+}
+
+func (r *IdempotencyMemory) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	existing, ok := r.records[k]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if existing.Completed || existing.LockToken != record.LockToken {
+		return nil
+	}
+
+	existing.Completed = true
+	existing.StatusCode = record.StatusCode
+	existing.ContentType = record.ContentType
+	existing.ResponseBody = record.ResponseBody
+	r.records[k] = existing
+
+	return nil
+}
+
+func (r *IdempotencyMemory) Delete(ctx context.Context, record models.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if existing, ok := r.records[k]; ok && !existing.Completed && existing.LockToken == record.LockToken {
+		delete(r.records, k)
+	}
+	return nil
+}
+
+func (r *IdempotencyMemory) DeleteExpired(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for k, record := range r.records {
+		if now.After(record.ExpiresAt) {
+			delete(r.records, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyMemory_Reserve(t *testing.T) {
+	ctx := context.Background()
+	repo := NewIdempotencyMemory()
+	first := models.IdempotencyRecord{UserID: 1, Key: "key", RequestHash: "hash", LockToken: "first"}
+
+	_, reserved, err := repo.Reserve(ctx, first, time.Hour, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	// a retry while the first request still holds its lease is refused
+	retry := first
+	retry.LockToken = "retry"
+	_, reserved, err = repo.Reserve(ctx, retry, time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.False(t, reserved)
+
+	// a different request can't take the key over even once the lease expired
+	time.Sleep(20 * time.Millisecond)
+	other := retry
+	other.RequestHash = "other"
+	_, reserved, err = repo.Reserve(ctx, other, time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.False(t, reserved)
+
+	_, reserved, err = repo.Reserve(ctx, retry, time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	// the abandoned request finishing late leaves the retry's reservation alone
+	require.NoError(t, repo.Delete(ctx, first))
+	first.StatusCode = 201
+	require.NoError(t, repo.Complete(ctx, first))
+
+	existing, reserved, err := repo.Reserve(ctx, retry, time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.False(t, reserved)
+	require.False(t, existing.Completed)
+	require.Equal(t, "retry", existing.LockToken)
+
+	retry.StatusCode = 201
+	require.NoError(t, repo.Complete(ctx, retry))
+	existing, _, err = repo.Reserve(ctx, retry, time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.True(t, existing.Completed)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type IdempotencyPostgres struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyPostgres(db *gorm.DB) *IdempotencyPostgres {
+	return &IdempotencyPostgres{db: db}
+}
+
+func (r *IdempotencyPostgres) Reserve(ctx context.Context, record models.IdempotencyRecord, ttl,
+	lease time.Duration) (models.IdempotencyRecord, bool, error) {
+	// an expired record is taken over as if it didn't exist, an abandoned
+	// reservation of the same request once its lock has expired
+	sqlQuery := `INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at, lock_token, locked_until)
+					VALUES (?, ?, ?, now() + make_interval(secs => ?), ?, now() + make_interval(secs => ?))
+					ON CONFLICT (user_id, key) DO UPDATE
+						SET request_hash  = EXCLUDED.request_hash,
+							completed     = false,
+							status_code   = 0,
+							content_type  = '',
+							response_body = NULL,
+							created_at    = now(),
+							expires_at    = EXCLUDED.expires_at,
+							lock_token    = EXCLUDED.lock_token,
+							locked_until  = EXCLUDED.locked_until
+						WHERE idempotency_keys.expires_at < now()
+						   OR (NOT idempotency_keys.completed
+							   AND idempotency_keys.request_hash = EXCLUDED.request_hash
+							   AND idempotency_keys.locked_until < now())
+					RETURNING user_id`
+	var reserved []int
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, record.UserID, record.Key, record.RequestHash, ttl.Seconds(),
+		record.LockToken, lease.Seconds()).Scan(&reserved).Error; err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	if len(reserved) == 1 {
+		return record, true, nil
+	}
+
+	existing, err := r.get(ctx, record.UserID, record.Key)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (r *IdempotencyPostgres) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	sqlQuery := `UPDATE idempotency_keys
+					SET completed     = true,
+						status_code   = ?,
+						content_type  = ?,
+						response_body = ?,
+						locked_until  = NULL
+					WHERE user_id = ? AND key = ? AND lock_token = ? AND NOT completed`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, record.StatusCode, record.ContentType, record.ResponseBody,
+		record.UserID, record.Key, record.LockToken).Error
+	return err
+}
+
+func (r *IdempotencyPostgres) Delete(ctx context.Context, record models.IdempotencyRecord) error {
+	sqlQuery := `DELETE FROM idempotency_keys
+					WHERE user_id = ? AND key = ? AND lock_token = ? AND NOT completed`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, record.UserID, record.Key, record.LockToken).Error
+	return err
+}
+
+func (r *IdempotencyPostgres) DeleteExpired(ctx context.Context) error {
+	sqlQuery := `DELETE FROM idempotency_keys WHERE expires_at < now()`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery).Error
+	return err
+}
+
+func (r *IdempotencyPostgres) get(ctx context.Context, userID int, key string) (record models.IdempotencyRecord, err error) {
+	sqlQuery := `SELECT user_id, key, request_hash, completed, status_code, content_type,
+						response_body, expires_at
+					FROM idempotency_keys
+					WHERE user_id = ? AND key = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, key).Scan(&record).Error; err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	if record.UserID == 0 {
+		return models.IdempotencyRecord{}, gorm.ErrRecordNotFound
+	}
+
+	return record, nil
+}
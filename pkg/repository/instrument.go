@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/pkg/metrics"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	metricsStartKey = "instrument:start"
+	tracingSpanKey  = "instrument:span"
+)
+
+// InstrumentDB times every query run through db, traces the ones run with a
+// traced context and exports the pool stats, labelled with name.
+func InstrumentDB(db *gorm.DB, name string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err = metrics.RegisterDB(sqlDB, name); err != nil {
+		return err
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("instrument:before_create", startQuery("create")),
+		cb.Create().After("gorm:create").Register("instrument:after_create", observeQuery(name, "create")),
+		cb.Query().Before("gorm:query").Register("instrument:before_query", startQuery("query")),
+		cb.Query().After("gorm:query").Register("instrument:after_query", observeQuery(name, "query")),
+		cb.Update().Before("gorm:update").Register("instrument:before_update", startQuery("update")),
+		cb.Update().After("gorm:update").Register("instrument:after_update", observeQuery(name, "update")),
+		cb.Delete().Before("gorm:delete").Register("instrument:before_delete", startQuery("delete")),
+		cb.Delete().After("gorm:delete").Register("instrument:after_delete", observeQuery(name, "delete")),
+		cb.Row().Before("gorm:row").Register("instrument:before_row", startQuery("row")),
+		cb.Row().After("gorm:row").Register("instrument:after_row", observeQuery(name, "row")),
+		cb.Raw().Before("gorm:raw").Register("instrument:before_raw", startQuery("raw")),
+		cb.Raw().After("gorm:raw").Register("instrument:after_raw", observeQuery(name, "raw")),
+	)
+}
+
+func startQuery(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		db.InstanceSet(metricsStartKey, time.Now())
+
+		// queries outside a traced request would each start a trace of their own
+		ctx := db.Statement.Context
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+		_, span := tracing.Start(ctx, db.Dialector.Name()+" "+operation, trace.WithSpanKind(trace.SpanKindClient))
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func observeQuery(name, operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		endSpan(db)
+
+		start, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+
+		metrics.DBQueryDuration.WithLabelValues(name, operation).Observe(time.Since(start.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			metrics.DBQueryErrors.WithLabelValues(name, operation).Inc()
+		}
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+
+	system := db.Dialector.Name()
+	if system == "postgres" {
+		system = "postgresql"
+	}
+
+	span := value.(trace.Span)
+	span.SetAttributes(
+		semconv.DBSystemKey.String(system),
+		semconv.DBStatement(db.Statement.SQL.String()),
+	)
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"sync"
+	"time"
+)
+
+type memoryAttempt struct {
+	attempt       models.LoginAttempt
+	lastFailureAt time.Time
+}
+
+// LoginAttemptMemory counts failed logins in process memory, so lockouts are
+// per instance and end with a restart.
+type LoginAttemptMemory struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+func NewLoginAttemptMemory() *LoginAttemptMemory {
+	return &LoginAttemptMemory{attempts: make(map[string]*memoryAttempt)}
+}
+
+func (r *LoginAttemptMemory) Get(ctx context.Context, key string) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, ok := r.attempts[key]; ok {
+		return a.attempt, nil
+	}
+
+	return models.LoginAttempt{Key: key}, nil
+}
+
+func (r *LoginAttemptMemory) RegisterFailure(ctx context.Context, key string, window time.Duration) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	a, ok := r.attempts[key]
+	if !ok {
+		a = &memoryAttempt{attempt: models.LoginAttempt{Key: key}}
+		r.attempts[key] = a
+	}
+
+	// failures older than the window don't count
+	if now.Sub(a.lastFailureAt) > window {
+		a.attempt.Failures = 0
+	}
+	a.attempt.Failures++
+	a.lastFailureAt = now
+
+	return a.attempt, nil
+}
+
+func (r *LoginAttemptMemory) Lock(ctx context.Context, key string, duration time.Duration) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lockedUntil := time.Now().Add(duration)
+	if a, ok := r.attempts[key]; ok {
+		a.attempt.LockedUntil = &lockedUntil
+		a.attempt.Lockouts++
+	}
+
+	return lockedUntil, nil
+}
+
+func (r *LoginAttemptMemory) Unlock(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, ok := r.attempts[key]; ok {
+		a.attempt.LockedUntil = nil
+		a.attempt.Failures = 0
+	}
+
+	return nil
+}
+
+func (r *LoginAttemptMemory) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type LoginAttemptPostgres struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptPostgres(db *gorm.DB) *LoginAttemptPostgres {
+	return &LoginAttemptPostgres{db: db}
+}
+
+func (r *LoginAttemptPostgres) Get(ctx context.Context, key string) (attempt models.LoginAttempt, err error) {
+	sqlQuery := `SELECT key, failures, lockouts, locked_until FROM login_attempts WHERE key = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, key).Scan(&attempt).Error; err != nil {
+		return models.LoginAttempt{}, err
+	}
+
+	attempt.Key = key
+	return attempt, nil
+}
+
+func (r *LoginAttemptPostgres) RegisterFailure(ctx context.Context, key string, window time.Duration) (attempt models.LoginAttempt, err error) {
+	// failures older than the window don't count
+	sqlQuery := `INSERT INTO login_attempts (key, failures, last_failure_at)
+					VALUES (?, 1, now())
+					ON CONFLICT (key) DO UPDATE
+						SET failures        = CASE
+												  WHEN login_attempts.last_failure_at < now() - make_interval(secs => ?)
+													  THEN 1
+												  ELSE login_attempts.failures + 1
+							END,
+							last_failure_at = now()
+					RETURNING key, failures, lockouts, locked_until`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, key, window.Seconds()).Scan(&attempt).Error; err != nil {
+		return models.LoginAttempt{}, err
+	}
+
+	return attempt, nil
+}
+
+func (r *LoginAttemptPostgres) Lock(ctx context.Context, key string, duration time.Duration) (lockedUntil time.Time, err error) {
+	sqlQuery := `UPDATE login_attempts
+					SET locked_until = now() + make_interval(secs => ?),
+						lockouts     = lockouts + 1
+					WHERE key = ?
+					RETURNING locked_until`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, duration.Seconds(), key).Scan(&lockedUntil).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	return lockedUntil, nil
+}
+
+func (r *LoginAttemptPostgres) Unlock(ctx context.Context, key string) error {
+	sqlQuery := `UPDATE login_attempts SET locked_until = NULL, failures = 0 WHERE key = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, key).Error
+	return err
+}
+
+func (r *LoginAttemptPostgres) Reset(ctx context.Context, key string) error {
+	sqlQuery := `DELETE FROM login_attempts WHERE key = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, key).Error
+	return err
+}
@@ -1,10 +1,16 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -12,48 +18,150 @@ const (
 	todoItemsTable = "todo_items"
 )
 
+const (
+	connectInitialBackoff = 500 * time.Millisecond
+	connectMaxBackoff     = 10 * time.Second
+)
+
 type Config struct {
+	// URL is a postgres:// URL or key=value DSN. When set it replaces Host,
+	// Port, Username, Password, DBName and SSLMode.
+	URL      string
 	Host     string
 	Port     string
 	Username string
 	Password string
 	DBName   string
 	SSLMode  string
+	// StatementTimeout makes Postgres cancel statements that run longer; zero
+	// leaves the server default.
+	StatementTimeout time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout is how long NewPostgresDB keeps retrying before giving
+	// up; zero tries once.
+	ConnectTimeout time.Duration
 }
 
+// DSN returns the connection string for cfg. StatementTimeout is added to
+// a configured URL unless it already sets one.
+func (cfg Config) DSN() string {
+	timeout := ""
+	if cfg.StatementTimeout > 0 {
+		timeout = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if cfg.URL != "" {
+		if timeout == "" || strings.Contains(cfg.URL, "statement_timeout") {
+			return cfg.URL
+		}
+		if u, err := url.Parse(cfg.URL); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+			query := u.Query()
+			query.Set("statement_timeout", timeout)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+		return cfg.URL + " statement_timeout=" + timeout
+	}
+
+	query := url.Values{}
+	if cfg.SSLMode != "" {
+		query.Set("sslmode", cfg.SSLMode)
+	}
+	if timeout != "" {
+		query.Set("statement_timeout", timeout)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.DBName,
+		RawQuery: query.Encode(),
+	}
+	if cfg.Password == "" {
+		dsn.User = url.User(cfg.Username)
+	}
+
+	return dsn.String()
+}
+
+// NewPostgresDB connects to Postgres, retrying with backoff for up to
+// cfg.ConnectTimeout so the app can start before the database is ready.
 func NewPostgresDB(cfg Config) (*gorm.DB, error) {
-	connString := fmt.Sprintf(`host=%s 
-										port=%s 
-										user=%s 
-										dbname=%s 
-										password=%s
-										sslmode=%s`,
-		cfg.Host,
-		cfg.Port,
-		cfg.Username,
-		cfg.DBName,
-		cfg.Password,
-		cfg.SSLMode)
-	db, err := gorm.Open(postgres.Open(connString), &gorm.Config{})
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	backoff := connectInitialBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := openPostgres(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("connecting to database after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Couldn't connect to database (attempt %d), retrying in %s: %s", attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > connectMaxBackoff {
+			backoff = connectMaxBackoff
+		}
+	}
+}
+
+func openPostgres(cfg Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
 	if err != nil {
-		log.Println("Couldn't connect to database: ", err.Error())
 		return nil, err
 	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
-		log.Println("Couldn't get generic database object sql.DB to use its functions: ", err.Error())
 		return nil, err
 	}
 
-	if err = sqlDB.Ping(); err != nil {
-		log.Println("Couldn't send ping to database: ", err.Error())
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectMaxBackoff)
+	defer cancel()
+	if err = sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
+// NewPostgresReplicas connects to the read replicas at urls with the pool
+// settings of cfg. A replica that can't be reached is left out, reads then
+// go to the others or the primary.
+func NewPostgresReplicas(cfg Config, urls []string) []*gorm.DB {
+	replicas := make([]*gorm.DB, 0, len(urls))
+	for i, u := range urls {
+		replicaCfg := cfg
+		replicaCfg.URL = u
+		replicaCfg.ConnectTimeout = 0
+		db, err := NewPostgresDB(replicaCfg)
+		if err != nil {
+			log.Printf("Skipping read replica %d: %s", i+1, err)
+			continue
+		}
+		replicas = append(replicas, db)
+	}
+
+	return replicas
+}
+
 func PostgresCloseConnection(db *gorm.DB) error {
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -66,3 +174,13 @@ func PostgresCloseConnection(db *gorm.DB) error {
 
 	return nil
 }
+
+// PingDB checks that db can still reach the database.
+func PingDB(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
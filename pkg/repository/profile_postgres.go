@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ProfilePostgres struct {
+	db *gorm.DB
+}
+
+func NewProfilePostgres(db *gorm.DB) *ProfilePostgres {
+	return &ProfilePostgres{db: db}
+}
+
+type profileRow struct {
+	ID               int
+	Name             string
+	Username         string
+	Email            string
+	EmailVerified    bool
+	Timezone         string
+	Locale           string
+	Preferences      string
+	TwoFactorEnabled bool
+	DeleteAfter      *time.Time
+}
+
+func (r *ProfilePostgres) Get(ctx context.Context, userID int) (models.Profile, error) {
+	sqlQuery := fmt.Sprintf(`SELECT id, name, username, COALESCE(email, '') AS email, email_verified, timezone, locale,
+					       preferences::text AS preferences, totp_enabled AS two_factor_enabled, delete_after
+					FROM %s
+					WHERE id = ?`, usersTable)
+	var row profileRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&row).Error; err != nil {
+		return models.Profile{}, err
+	}
+
+	if row.ID == 0 {
+		return models.Profile{}, gorm.ErrRecordNotFound
+	}
+
+	return models.Profile{
+		ID:               row.ID,
+		Name:             row.Name,
+		Username:         row.Username,
+		Email:            row.Email,
+		EmailVerified:    row.EmailVerified,
+		Timezone:         row.Timezone,
+		Locale:           row.Locale,
+		Preferences:      []byte(row.Preferences),
+		TwoFactorEnabled: row.TwoFactorEnabled,
+		DeleteAfter:      row.DeleteAfter,
+	}, nil
+}
+
+func (r *ProfilePostgres) Update(ctx context.Context, userID int, input models.ProfileUpdateInput) error {
+	var preferences *string
+	if input.Preferences != nil {
+		p := string(*input.Preferences)
+		preferences = &p
+	}
+
+	sqlQuery := fmt.Sprintf(`UPDATE %s
+					SET name        = COALESCE(?, name),
+					    timezone    = COALESCE(?, timezone),
+					    locale      = COALESCE(?, locale),
+					    preferences = COALESCE(CAST(? AS jsonb), preferences)
+					WHERE id = ?`, usersTable)
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, input.Name, input.Timezone, input.Locale, preferences, userID).Error
+	return err
+}
+
+func (r *ProfilePostgres) ScheduleDeletion(ctx context.Context, userID int, grace time.Duration) (deleteAfter time.Time, err error) {
+	sqlQuery := fmt.Sprintf(`UPDATE %s
+					SET delete_after = COALESCE(delete_after, now() + make_interval(secs => ?))
+					WHERE id = ?
+					RETURNING delete_after`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, grace.Seconds(), userID).Scan(&deleteAfter).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	if deleteAfter.IsZero() {
+		return time.Time{}, gorm.ErrRecordNotFound
+	}
+
+	return deleteAfter, nil
+}
+
+func (r *ProfilePostgres) CancelDeletion(ctx context.Context, userID int) error {
+	sqlQuery := fmt.Sprintf(`UPDATE %s SET delete_after = NULL WHERE id = ?`, usersTable)
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, userID).Error
+	return err
+}
+
+func (r *ProfilePostgres) DeleteScheduled(ctx context.Context) (ids []int, err error) {
+	sqlQuery := fmt.Sprintf(`DELETE FROM %s WHERE delete_after <= now() RETURNING id`, usersTable)
+
+	if err = r.db.WithContext(ctx).Raw(sqlQuery).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// RateLimitMemory keeps token buckets in process memory, so limits are per instance.
+type RateLimitMemory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimitMemory() *RateLimitMemory {
+	return &RateLimitMemory{buckets: make(map[string]*bucket)}
+}
+
+func (r *RateLimitMemory) Take(ctx context.Context, key string, capacity, ratePerSecond float64) (float64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*ratePerSecond)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+func (r *RateLimitMemory) DeleteIdle(ctx context.Context, idleFor time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, b := range r.buckets {
+		if time.Since(b.updatedAt) > idleFor {
+			delete(r.buckets, key)
+		}
+	}
+
+	return nil
+}
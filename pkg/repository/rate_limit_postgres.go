@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// RateLimitPostgres keeps token buckets in Postgres so limits hold across instances.
+type RateLimitPostgres struct {
+	db *gorm.DB
+}
+
+func NewRateLimitPostgres(db *gorm.DB) *RateLimitPostgres {
+	return &RateLimitPostgres{db: db}
+}
+
+func (r *RateLimitPostgres) Take(ctx context.Context, key string, capacity, ratePerSecond float64) (float64, bool, error) {
+	// refilled is LEAST(capacity, tokens + elapsed * rate); the SET expressions
+	// all see the row as it was before the update
+	sqlQuery := `INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+					VALUES (@key, CAST(@capacity AS double precision) - 1, true, now())
+					ON CONFLICT (key) DO UPDATE
+						SET allowed    = LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate) >= 1,
+							tokens     = LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate) -
+										 CASE
+											 WHEN LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate) >= 1
+												 THEN 1
+											 ELSE 0
+											 END,
+							updated_at = now()
+					RETURNING tokens, allowed`
+	var result struct {
+		Tokens  float64
+		Allowed bool
+	}
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, map[string]interface{}{
+		"key":      key,
+		"capacity": capacity,
+		"rate":     ratePerSecond,
+	}).Scan(&result).Error; err != nil {
+		return 0, false, err
+	}
+
+	return result.Tokens, result.Allowed, nil
+}
+
+func (r *RateLimitPostgres) DeleteIdle(ctx context.Context, idleFor time.Duration) error {
+	sqlQuery := `DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => ?)`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, idleFor.Seconds()).Error
+	return err
+}
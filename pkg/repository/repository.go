@@ -1,33 +1,262 @@
 package repository
 
 import (
+	"context"
 	"github.com/NekruzRakhimov/todo_app/models"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Authorization interface {
-	CreateUser(user models.User) (int, error)
-	GetUser(username, password string) (models.User, error)
+	// CreateUser fails with ErrUsernameTaken or ErrEmailTaken on duplicates.
+	CreateUser(ctx context.Context, user models.User) (int, error)
+	// GetUser matches the username case-insensitively.
+	GetUser(ctx context.Context, username, password string) (models.User, error)
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	GetUserByID(ctx context.Context, userID int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	SetEmailVerified(ctx context.Context, userID int) error
 }
 
 type TodoItem interface {
-	Create(item models.TodoItem) (int, error)
-	BulkCreate(userID int, items []models.TodoItem) error
-	GetAll(userID int) ([]models.TodoItem, error)
-	GetByID(userID, itemID int) (models.TodoItem, error)
-	Delete(userID, itemID int) error
-	Update(userID, itemID int, input models.TodoItem) error
-	ChangeStatus(userID, itemID int, status bool) error
+	Create(ctx context.Context, item models.TodoItem) (int, error)
+	BulkCreate(ctx context.Context, userID int, items []models.TodoItem) ([]int, error)
+	GetAll(ctx context.Context, userID int) ([]models.TodoItem, error)
+	GetByID(ctx context.Context, userID, itemID int) (models.TodoItem, error)
+	Delete(ctx context.Context, userID, itemID int) error
+	Update(ctx context.Context, userID, itemID int, input models.TodoItem) error
+	ChangeStatus(ctx context.Context, userID, itemID int, status bool) error
+	GetChanges(ctx context.Context, userID int, sinceRevision int64, limit int) ([]models.SyncItem, error)
+	GetSyncItem(ctx context.Context, userID, itemID int) (models.SyncItem, error)
+	GetSyncItemByClientID(ctx context.Context, userID int, clientID string) (models.SyncItem, error)
+	ApplySyncChange(ctx context.Context, userID int, item models.SyncItem, baseVersion int) (bool, error)
+}
+
+type Webhook interface {
+	Create(ctx context.Context, webhook models.Webhook) (int, error)
+	GetAll(ctx context.Context, userID int) ([]models.Webhook, error)
+	GetByID(ctx context.Context, userID, webhookID int) (models.Webhook, error)
+	GetActiveByEvent(ctx context.Context, userID int, event string) ([]models.Webhook, error)
+	Delete(ctx context.Context, userID, webhookID int) error
+	GetActiveByID(ctx context.Context, webhookID int) (models.Webhook, error)
+	CreateDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error)
+	UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	// ClaimDueDeliveries returns up to limit pending deliveries whose next
+	// attempt is due, pushing that attempt lease into the future so other
+	// instances skip them meanwhile.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, userID, webhookID int) ([]models.WebhookDelivery, error)
+	GetDeliveryByID(ctx context.Context, userID, webhookID, deliveryID int) (models.WebhookDelivery, error)
+}
+
+type Idempotency interface {
+	// Reserve claims the key for a new request, locked for lease. A key
+	// whose lock has expired is taken over by the same request. If the key is
+	// already taken, the existing record is returned and reserved is false.
+	Reserve(ctx context.Context, record models.IdempotencyRecord, ttl, lease time.Duration) (existing models.IdempotencyRecord, reserved bool, err error)
+	// Complete and Delete only change the record while it is still held
+	// with record.LockToken.
+	Complete(ctx context.Context, record models.IdempotencyRecord) error
+	Delete(ctx context.Context, record models.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type RateLimit interface {
+	// Take removes a token from the bucket under key, refilling it first, and
+	// returns the tokens left and whether one was available.
+	Take(ctx context.Context, key string, capacity, ratePerSecond float64) (tokens float64, allowed bool, err error)
+	// DeleteIdle deletes the buckets not used for longer than idleFor.
+	DeleteIdle(ctx context.Context, idleFor time.Duration) error
+}
+
+type LoginAttempt interface {
+	Get(ctx context.Context, key string) (models.LoginAttempt, error)
+	// RegisterFailure counts a failed login, restarting the count when the
+	// previous failure is older than window.
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (models.LoginAttempt, error)
+	Lock(ctx context.Context, key string, duration time.Duration) (time.Time, error)
+	Unlock(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type AuthAudit interface {
+	Log(ctx context.Context, entry models.AuthAuditEntry) error
+}
+
+type UserToken interface {
+	Create(ctx context.Context, userID int, purpose, tokenHash string, ttl time.Duration) error
+	// Consume marks an unused, unexpired token as used and returns its user.
+	Consume(ctx context.Context, purpose, tokenHash string) (userID int, err error)
+	DeleteByUser(ctx context.Context, userID int, purpose string) error
+}
+
+type TwoFactor interface {
+	Get(ctx context.Context, userID int) (models.TwoFactor, error)
+	// SetSecret stores a pending secret; it has no effect once 2FA is enabled.
+	SetSecret(ctx context.Context, userID int, secret string) error
+	// Enable turns 2FA on and replaces the user's recovery codes.
+	Enable(ctx context.Context, userID int, step int64, codeHashes []string) error
+	Disable(ctx context.Context, userID int) error
+	// UpdateLastStep records step as used and reports false if it, or a later one, already was.
+	UpdateLastStep(ctx context.Context, userID int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+}
+
+type AccessToken interface {
+	// Create stores the token; a zero ttl means it never expires.
+	Create(ctx context.Context, token models.PersonalAccessToken, tokenHash string, ttl time.Duration) (models.PersonalAccessToken, error)
+	GetAll(ctx context.Context, userID int) ([]models.PersonalAccessToken, error)
+	// GetActiveByHash returns the token unless it is revoked or expired or its user is disabled.
+	GetActiveByHash(ctx context.Context, tokenHash string) (models.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, tokenID int) error
+	// Touch sets the last-used time, skipping the write if it was set within interval.
+	Touch(ctx context.Context, tokenID int, interval time.Duration) error
+}
+
+type Admin interface {
+	// ListUsers returns a page of users whose username, name or email contain
+	// search, and the total number of matches.
+	ListUsers(ctx context.Context, search string, limit, offset int) ([]models.AdminUser, int, error)
+	GetUser(ctx context.Context, userID int) (models.AdminUser, error)
+	SetDisabled(ctx context.Context, userID int, disabled bool) error
+	DeleteUser(ctx context.Context, userID int) error
+}
+
+type Profile interface {
+	Get(ctx context.Context, userID int) (models.Profile, error)
+	Update(ctx context.Context, userID int, input models.ProfileUpdateInput) error
+	// ScheduleDeletion marks the user for deletion after grace and returns
+	// when that is; scheduling again keeps the original time.
+	ScheduleDeletion(ctx context.Context, userID int, grace time.Duration) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID int) error
+	// DeleteScheduled deletes users whose grace period is over and returns
+	// their ids; their items and other data go with them through on delete
+	// cascade.
+	DeleteScheduled(ctx context.Context) ([]int, error)
+}
+
+type Export interface {
+	Create(ctx context.Context, userID int) (models.DataExport, error)
+	GetByID(ctx context.Context, exportID int) (models.DataExport, error)
+	GetAll(ctx context.Context, userID int) ([]models.DataExport, error)
+	// GetPending returns the user's latest export that is still pending and
+	// was started within since.
+	GetPending(ctx context.Context, userID int, since time.Duration) (models.DataExport, error)
+	MarkReady(ctx context.Context, exportID int, fileKey string, ttl time.Duration) error
+	MarkFailed(ctx context.Context, exportID int, message string) error
+	GetExpired(ctx context.Context) ([]models.DataExport, error)
+	Delete(ctx context.Context, exportID int) error
+	// GetItems returns all of the user's items, including soft-deleted ones.
+	GetItems(ctx context.Context, userID int) ([]models.ExportItem, error)
+	GetAuthHistory(ctx context.Context, userID int) ([]models.AuthAuditEntry, error)
+}
+
+// Transactor composes repository calls atomically.
+type Transactor interface {
+	// WithinTx runs fn in a transaction, committing if it returns nil and
+	// rolling back otherwise. The repositories passed to fn use the
+	// transaction, so every call through them takes part in it. Transactions
+	// failing on a serialization failure or deadlock are retried, so fn may
+	// run more than once.
+	WithinTx(ctx context.Context, fn func(repos *Repository) error) error
 }
 
 type Repository struct {
+	Transactor
 	Authorization
 	TodoItem
+	Webhook
+	Idempotency
+	RateLimit
+	LoginAttempt
+	AuthAudit
+	UserToken
+	TwoFactor
+	AccessToken
+	Admin
+	Profile
+	Export
 }
 
-func NewRepository(db *gorm.DB) *Repository {
-	return &Repository{
+// NewRepository builds the Postgres repositories. Item lists and lookups are
+// read from replicas when any are given.
+func NewRepository(db *gorm.DB, replicas ...*gorm.DB) *Repository {
+	repos := &Repository{
 		Authorization: NewAuthPostgres(db),
-		TodoItem:      NewTodoItemPostgres(db),
+		TodoItem:      NewTodoItemPostgres(db, replicas...),
+		Webhook:       NewWebhookPostgres(db),
+		Idempotency:   NewIdempotencyPostgres(db),
+		RateLimit:     NewRateLimitPostgres(db),
+		LoginAttempt:  NewLoginAttemptPostgres(db),
+		AuthAudit:     NewAuthAuditPostgres(db),
+		UserToken:     NewUserTokenPostgres(db),
+		TwoFactor:     NewTwoFactorPostgres(db),
+		AccessToken:   NewAccessTokenPostgres(db),
+		Admin:         NewAdminPostgres(db),
+		Profile:       NewProfilePostgres(db),
+		Export:        NewExportPostgres(db),
+	}
+
+	repos.Transactor = &gormTransactor{db: db, bind: func(tx *gorm.DB) *Repository {
+		txRepos := NewRepository(tx)
+		// keep the in-memory stores main may have swapped in
+		if _, ok := repos.Idempotency.(*IdempotencyPostgres); !ok {
+			txRepos.Idempotency = repos.Idempotency
+		}
+		if _, ok := repos.RateLimit.(*RateLimitPostgres); !ok {
+			txRepos.RateLimit = repos.RateLimit
+		}
+		return txRepos
+	}}
+
+	return repos
+}
+
+// NewSQLiteRepository stores users and items in SQLite, for single-binary
+// deployments. Lockouts, idempotency keys and rate limits are kept in memory
+// and audit entries go to the log; the other features need Postgres and
+// fail with ErrNotSupported.
+func NewSQLiteRepository(db *gorm.DB) *Repository {
+	repos := newPartialRepository(NewAuthSQLite(db), NewTodoItemSQLite(db))
+
+	var bind func(tx *gorm.DB) *Repository
+	bind = func(tx *gorm.DB) *Repository {
+		txRepos := *repos
+		txRepos.Authorization = NewAuthSQLite(tx)
+		txRepos.TodoItem = NewTodoItemSQLite(tx)
+		txRepos.Transactor = &gormTransactor{db: tx, bind: bind}
+		return &txRepos
+	}
+	repos.Transactor = &gormTransactor{db: db, bind: bind}
+
+	return repos
+}
+
+// NewMemoryRepository keeps users and items in process memory, for tests and
+// demos, with the same limits as NewSQLiteRepository.
+func NewMemoryRepository() *Repository {
+	repos := newPartialRepository(NewAuthMemory(), NewTodoItemMemory())
+	repos.Transactor = newMemoryTransactor(repos)
+
+	return repos
+}
+
+func newPartialRepository(auth Authorization, items TodoItem) *Repository {
+	return &Repository{
+		Authorization: auth,
+		TodoItem:      items,
+		Webhook:       unsupportedWebhook{},
+		Idempotency:   NewIdempotencyMemory(),
+		RateLimit:     NewRateLimitMemory(),
+		LoginAttempt:  NewLoginAttemptMemory(),
+		AuthAudit:     NewAuthAuditLogger(),
+		UserToken:     unsupportedUserToken{},
+		TwoFactor:     unsupportedTwoFactor{},
+		AccessToken:   unsupportedAccessToken{},
+		Admin:         unsupportedAdmin{},
+		Profile:       unsupportedProfile{},
+		Export:        unsupportedExport{},
 	}
 }
@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The conformance tests run the same cases against every backend of the
+// users and items repositories, so the memory and SQLite stand-ins keep
+// behaving like Postgres. The Postgres backend runs only when
+// TODO_TEST_POSTGRES_URL is set.
+//
+// Isolation isn't covered: the memory transactor has none, see
+// memoryTransactor.
+
+type backend struct {
+	name string
+	open func(t *testing.T) *Repository
+}
+
+var backends = []backend{
+	{name: "memory", open: func(t *testing.T) *Repository {
+		return NewMemoryRepository()
+	}},
+	{name: "sqlite", open: func(t *testing.T) *Repository {
+		db, err := NewSQLiteDB(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			sqlDB, _ := db.DB()
+			_ = sqlDB.Close()
+		})
+		return NewSQLiteRepository(db)
+	}},
+	{name: "postgres", open: func(t *testing.T) *Repository {
+		db := openTestPostgres(t)
+		// the database is shared between runs, so drop what the test created
+		t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE username LIKE ?`, uniquePrefix+"%") })
+		return NewRepository(db)
+	}},
+}
+
+// uniquePrefix keeps the users of one run apart from those of other runs
+// against the same Postgres database.
+var uniquePrefix = fmt.Sprintf("conformance_%d_", time.Now().UnixNano())
+
+var uniqueSeq atomic.Int64
+
+func unique(name string) string {
+	return fmt.Sprintf("%s%s_%d", uniquePrefix, name, uniqueSeq.Add(1))
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, repos *Repository)
+}
+
+// runConformance runs every case against a fresh repository of each backend.
+func runConformance(t *testing.T, cases []conformanceCase) {
+	for _, b := range backends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			for _, tc := range cases {
+				tc := tc
+				t.Run(tc.name, func(t *testing.T) {
+					tc.run(t, b.open(t))
+				})
+			}
+		})
+	}
+}
+
+func newConformanceUser(t *testing.T, repos *Repository) int {
+	t.Helper()
+
+	userID, err := repos.Authorization.CreateUser(context.Background(), models.User{Name: "Test", Username: unique("user"), Password: "hash"})
+	require.NoError(t, err)
+
+	return userID
+}
+
+func TestAuthorizationConformance(t *testing.T) {
+	ctx := context.Background()
+
+	runConformance(t, []conformanceCase{
+		{name: "create and look up", run: func(t *testing.T, repos *Repository) {
+			username, email := unique("Alice"), unique("alice")+"@example.com"
+			userID, err := repos.Authorization.CreateUser(ctx, models.User{
+				Name: "Alice", Username: username, Password: "hash", Email: email,
+			})
+			require.NoError(t, err)
+
+			want := models.User{ID: userID, Name: "Alice", Username: username, Email: email, Role: models.RoleUser}
+
+			user, err := repos.Authorization.GetUserByID(ctx, userID)
+			require.NoError(t, err)
+			require.Equal(t, want, user)
+
+			// usernames and emails match case-insensitively
+			user, err = repos.Authorization.GetUserByUsername(ctx, strings.ToLower(username))
+			require.NoError(t, err)
+			require.Equal(t, want, user)
+
+			user, err = repos.Authorization.GetUserByEmail(ctx, strings.ToUpper(email))
+			require.NoError(t, err)
+			require.Equal(t, want, user)
+
+			user, err = repos.Authorization.GetUser(ctx, strings.ToLower(username), "hash")
+			require.NoError(t, err)
+			require.Equal(t, want, user)
+
+			exists, err := repos.Authorization.UsernameExists(ctx, strings.ToUpper(username))
+			require.NoError(t, err)
+			require.True(t, exists)
+		}},
+		{name: "not found", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			user, err := repos.Authorization.GetUserByID(ctx, userID)
+			require.NoError(t, err)
+
+			_, err = repos.Authorization.GetUser(ctx, user.Username, "wrong")
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+			_, err = repos.Authorization.GetUserByID(ctx, userID+1000000)
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+			_, err = repos.Authorization.GetUserByUsername(ctx, unique("nobody"))
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+			_, err = repos.Authorization.GetUserByEmail(ctx, unique("nobody")+"@example.com")
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+			exists, err := repos.Authorization.UsernameExists(ctx, unique("nobody"))
+			require.NoError(t, err)
+			require.False(t, exists)
+		}},
+		{name: "duplicates", run: func(t *testing.T, repos *Repository) {
+			username, email := unique("bob"), unique("bob")+"@example.com"
+			_, err := repos.Authorization.CreateUser(ctx, models.User{Name: "Bob", Username: username, Password: "hash", Email: email})
+			require.NoError(t, err)
+
+			_, err = repos.Authorization.CreateUser(ctx, models.User{Name: "Bob", Username: strings.ToUpper(username), Password: "hash"})
+			require.ErrorIs(t, err, ErrUsernameTaken)
+
+			_, err = repos.Authorization.CreateUser(ctx, models.User{
+				Name: "Bob", Username: unique("bob"), Password: "hash", Email: strings.ToUpper(email),
+			})
+			require.ErrorIs(t, err, ErrEmailTaken)
+
+			// users without an email don't clash
+			_, err = repos.Authorization.CreateUser(ctx, models.User{Name: "Bob", Username: unique("bob"), Password: "hash"})
+			require.NoError(t, err)
+			_, err = repos.Authorization.CreateUser(ctx, models.User{Name: "Bob", Username: unique("bob"), Password: "hash"})
+			require.NoError(t, err)
+		}},
+		{name: "update password", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			user, err := repos.Authorization.GetUserByID(ctx, userID)
+			require.NoError(t, err)
+
+			require.NoError(t, repos.Authorization.UpdatePassword(ctx, userID, "new hash"))
+
+			_, err = repos.Authorization.GetUser(ctx, user.Username, "hash")
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			_, err = repos.Authorization.GetUser(ctx, user.Username, "new hash")
+			require.NoError(t, err)
+		}},
+	})
+}
+
+func TestTodoItemConformance(t *testing.T) {
+	ctx := context.Background()
+
+	runConformance(t, []conformanceCase{
+		{name: "create and read", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			otherID := newConformanceUser(t, repos)
+
+			firstID, err := repos.TodoItem.Create(ctx, models.TodoItem{Title: "first", Description: "one", UserID: userID})
+			require.NoError(t, err)
+			ids, err := repos.TodoItem.BulkCreate(ctx, userID, []models.TodoItem{
+				{Title: "second"}, {Title: "third", Done: true},
+			})
+			require.NoError(t, err)
+			require.Len(t, ids, 2)
+			_, err = repos.TodoItem.Create(ctx, models.TodoItem{Title: "other", UserID: otherID})
+			require.NoError(t, err)
+
+			items, err := repos.TodoItem.GetAll(ctx, userID)
+			require.NoError(t, err)
+			require.Equal(t, []models.TodoItem{
+				{ID: firstID, Title: "first", Description: "one"},
+				{ID: ids[0], Title: "second"},
+				{ID: ids[1], Title: "third", Done: true},
+			}, items)
+
+			item, err := repos.TodoItem.GetByID(ctx, userID, firstID)
+			require.NoError(t, err)
+			require.Equal(t, models.TodoItem{ID: firstID, Title: "first", Description: "one"}, item)
+
+			// another user's item doesn't exist for them
+			_, err = repos.TodoItem.GetByID(ctx, otherID, firstID)
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		}},
+		{name: "update and change status", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			otherID := newConformanceUser(t, repos)
+			itemID, err := repos.TodoItem.Create(ctx, models.TodoItem{Title: "title", UserID: userID})
+			require.NoError(t, err)
+
+			require.NoError(t, repos.TodoItem.Update(ctx, userID, itemID,
+				models.TodoItem{Title: "new title", Description: "new description"}))
+			require.NoError(t, repos.TodoItem.ChangeStatus(ctx, userID, itemID, true))
+
+			// writes to another user's item find nothing
+			err = repos.TodoItem.Update(ctx, otherID, itemID, models.TodoItem{Title: "stolen"})
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			require.ErrorIs(t, repos.TodoItem.ChangeStatus(ctx, otherID, itemID, false), gorm.ErrRecordNotFound)
+			require.ErrorIs(t, repos.TodoItem.Delete(ctx, otherID, itemID), gorm.ErrRecordNotFound)
+
+			item, err := repos.TodoItem.GetByID(ctx, userID, itemID)
+			require.NoError(t, err)
+			require.Equal(t, models.TodoItem{ID: itemID, Title: "new title", Description: "new description", Done: true}, item)
+
+			synced, err := repos.TodoItem.GetSyncItem(ctx, userID, itemID)
+			require.NoError(t, err)
+			require.Equal(t, 3, synced.Version)
+		}},
+		{name: "soft delete", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			itemID, err := repos.TodoItem.Create(ctx, models.TodoItem{Title: "title", UserID: userID, ClientID: "c1"})
+			require.NoError(t, err)
+
+			require.NoError(t, repos.TodoItem.Delete(ctx, userID, itemID))
+
+			_, err = repos.TodoItem.GetByID(ctx, userID, itemID)
+			require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+			// a removed item can't be removed or changed again
+			require.ErrorIs(t, repos.TodoItem.Delete(ctx, userID, itemID), gorm.ErrRecordNotFound)
+			require.ErrorIs(t, repos.TodoItem.ChangeStatus(ctx, userID, itemID, true), gorm.ErrRecordNotFound)
+
+			items, err := repos.TodoItem.GetAll(ctx, userID)
+			require.NoError(t, err)
+			require.Empty(t, items)
+
+			// sync still sees the item, as a tombstone
+			synced, err := repos.TodoItem.GetSyncItem(ctx, userID, itemID)
+			require.NoError(t, err)
+			require.True(t, synced.IsRemoved)
+			require.Equal(t, 2, synced.Version)
+
+			synced, err = repos.TodoItem.GetSyncItemByClientID(ctx, userID, "c1")
+			require.NoError(t, err)
+			require.Equal(t, itemID, synced.ID)
+		}},
+		{name: "changes in revision order", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			otherID := newConformanceUser(t, repos)
+
+			ids, err := repos.TodoItem.BulkCreate(ctx, userID, []models.TodoItem{{Title: "a"}, {Title: "b"}, {Title: "c"}})
+			require.NoError(t, err)
+			_, err = repos.TodoItem.Create(ctx, models.TodoItem{Title: "other", UserID: otherID})
+			require.NoError(t, err)
+
+			changes, err := repos.TodoItem.GetChanges(ctx, userID, 0, 100)
+			require.NoError(t, err)
+			require.Equal(t, ids, syncIDs(changes))
+			since := changes[len(changes)-1].Revision
+
+			// a write moves the item behind the others
+			require.NoError(t, repos.TodoItem.ChangeStatus(ctx, userID, ids[0], true))
+			require.NoError(t, repos.TodoItem.Delete(ctx, userID, ids[1]))
+
+			changes, err = repos.TodoItem.GetChanges(ctx, userID, 0, 100)
+			require.NoError(t, err)
+			require.Equal(t, []int{ids[2], ids[0], ids[1]}, syncIDs(changes))
+			for i := 1; i < len(changes); i++ {
+				require.Less(t, changes[i-1].Revision, changes[i].Revision)
+			}
+
+			changes, err = repos.TodoItem.GetChanges(ctx, userID, since, 100)
+			require.NoError(t, err)
+			require.Equal(t, []int{ids[0], ids[1]}, syncIDs(changes))
+			require.True(t, changes[1].IsRemoved)
+
+			changes, err = repos.TodoItem.GetChanges(ctx, userID, 0, 2)
+			require.NoError(t, err)
+			require.Equal(t, []int{ids[2], ids[0]}, syncIDs(changes))
+		}},
+		{name: "apply sync change", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			otherID := newConformanceUser(t, repos)
+			itemID, err := repos.TodoItem.Create(ctx, models.TodoItem{Title: "title", UserID: userID})
+			require.NoError(t, err)
+
+			change := models.SyncItem{ID: itemID, Title: "synced", Description: "description", Done: true}
+
+			tests := []struct {
+				name        string
+				userID      int
+				baseVersion int
+				applied     bool
+				version     int
+			}{
+				{name: "stale version", userID: userID, baseVersion: 0, applied: false, version: 1},
+				{name: "another user", userID: otherID, baseVersion: 1, applied: false, version: 1},
+				{name: "current version", userID: userID, baseVersion: 1, applied: true, version: 2},
+				{name: "replayed", userID: userID, baseVersion: 1, applied: false, version: 2},
+			}
+			for _, tt := range tests {
+				applied, err := repos.TodoItem.ApplySyncChange(ctx, tt.userID, change, tt.baseVersion)
+				require.NoError(t, err, tt.name)
+				require.Equal(t, tt.applied, applied, tt.name)
+
+				synced, err := repos.TodoItem.GetSyncItem(ctx, userID, itemID)
+				require.NoError(t, err, tt.name)
+				require.Equal(t, tt.version, synced.Version, tt.name)
+			}
+
+			synced, err := repos.TodoItem.GetSyncItem(ctx, userID, itemID)
+			require.NoError(t, err)
+			require.Equal(t, "synced", synced.Title)
+			require.Equal(t, "description", synced.Description)
+			require.True(t, synced.Done)
+		}},
+		{name: "rollback", run: func(t *testing.T, repos *Repository) {
+			userID := newConformanceUser(t, repos)
+			itemID, err := repos.TodoItem.Create(ctx, models.TodoItem{Title: "kept", UserID: userID})
+			require.NoError(t, err)
+
+			errRollback := errors.New("rollback")
+			err = repos.Transactor.WithinTx(ctx, func(txRepos *Repository) error {
+				if _, err := txRepos.TodoItem.Create(ctx, models.TodoItem{Title: "dropped", UserID: userID}); err != nil {
+					return err
+				}
+				if err := txRepos.TodoItem.ChangeStatus(ctx, userID, itemID, true); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			require.ErrorIs(t, err, errRollback)
+
+			items, err := repos.TodoItem.GetAll(ctx, userID)
+			require.NoError(t, err)
+			require.Equal(t, []models.TodoItem{{ID: itemID, Title: "kept"}}, items)
+		}},
+	})
+}
+
+func syncIDs(items []models.SyncItem) []int {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+// sqliteSchema creates the tables the SQLite backend supports. It mirrors the
+// users and todo_items columns of the Postgres migrations.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users
+(
+    id             integer primary key autoincrement,
+    name           text      not null,
+    username       text      not null,
+    password_hash  text      not null,
+    email          text,
+    email_verified boolean   not null default false,
+    role           text      not null default 'user',
+    disabled_at    timestamp
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_idx ON users (lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email)) WHERE email IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS todo_items
+(
+    id          integer primary key autoincrement,
+    user_id     integer   not null references users (id) on delete cascade,
+    title       text      not null,
+    description text,
+    done        boolean   not null default false,
+    is_removed  boolean   not null default false,
+    client_id   text,
+    version     integer   not null default 1,
+    revision    integer   not null,
+    created_at  timestamp not null,
+    updated_at  timestamp not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS todo_items_user_client_id_idx ON todo_items (user_id, client_id) WHERE client_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS todo_items_user_revision_idx ON todo_items (user_id, revision);
+CREATE INDEX IF NOT EXISTS todo_items_revision_idx ON todo_items (revision);
+`
+
+// NewSQLiteDB opens the database file at path, ":memory:" for a throwaway
+// one, and creates the schema. Writes are serialized over one connection.
+func NewSQLiteDB(path string) (*gorm.DB, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Println("Couldn't open sqlite database: ", err.Error())
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, statement := range strings.Split(sqliteSchema, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if err = db.Exec(statement).Error; err != nil {
+			log.Println("Couldn't create sqlite schema: ", err.Error())
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// isSQLiteUniqueViolation reports whether err comes from the named unique index.
+func isSQLiteUniqueViolation(err error, index string) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") &&
+		strings.Contains(err.Error(), index)
+}
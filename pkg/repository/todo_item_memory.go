@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errClientIDTaken = errors.New("an item with this client_id already exists")
+
+type memoryItem struct {
+	userID int
+	item   models.SyncItem
+}
+
+// TodoItemMemory keeps items in process memory, for tests and demos. Like
+// the Postgres trigger, every write bumps the item's version and gives it a
+// new revision for sync. Nothing blocks, so the contexts are ignored.
+type TodoItemMemory struct {
+	mu       sync.RWMutex
+	items    map[int]*memoryItem
+	nextID   int
+	revision int64
+}
+
+func NewTodoItemMemory() *TodoItemMemory {
+	return &TodoItemMemory{items: make(map[int]*memoryItem)}
+}
+
+func (r *TodoItemMemory) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	items := make(map[int]*memoryItem, len(r.items))
+	for id, m := range r.items {
+		copied := *m
+		items[id] = &copied
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.items = items
+	}
+}
+
+func (r *TodoItemMemory) Create(ctx context.Context, item models.TodoItem) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if item.ClientID != "" && r.findByClientID(item.UserID, item.ClientID) != nil {
+		return 0, errClientIDTaken
+	}
+
+	r.nextID++
+	r.revision++
+	r.items[r.nextID] = &memoryItem{
+		userID: item.UserID,
+		item: models.SyncItem{
+			ID:          r.nextID,
+			ClientID:    item.ClientID,
+			Title:       item.Title,
+			Description: item.Description,
+			Done:        item.Done,
+			Version:     1,
+			Revision:    r.revision,
+			UpdatedAt:   time.Now(),
+		},
+	}
+
+	return r.nextID, nil
+}
+
+func (r *TodoItemMemory) BulkCreate(ctx context.Context, userID int, items []models.TodoItem) ([]int, error) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		item.UserID = userID
+		id, err := r.Create(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (r *TodoItemMemory) GetAll(ctx context.Context, userID int) ([]models.TodoItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var items []models.TodoItem
+	for _, m := range r.items {
+		if m.userID == userID && !m.item.IsRemoved {
+			items = append(items, toTodoItem(m.item))
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+
+	return items, nil
+}
+
+func (r *TodoItemMemory) GetByID(ctx context.Context, userID, itemID int) (models.TodoItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.items[itemID]
+	if !ok || m.userID != userID || m.item.IsRemoved {
+		return models.TodoItem{}, gorm.ErrRecordNotFound
+	}
+
+	return toTodoItem(m.item), nil
+}
+
+func (r *TodoItemMemory) Delete(ctx context.Context, userID, itemID int) error {
+	return r.update(userID, itemID, func(item *models.SyncItem) {
+		item.IsRemoved = true
+	})
+}
+
+func (r *TodoItemMemory) Update(ctx context.Context, userID, itemID int, input models.TodoItem) error {
+	return r.update(userID, itemID, func(item *models.SyncItem) {
+		item.Title = input.Title
+		item.Description = input.Description
+		item.Done = input.Done
+	})
+}
+
+func (r *TodoItemMemory) ChangeStatus(ctx context.Context, userID, itemID int, status bool) error {
+	return r.update(userID, itemID, func(item *models.SyncItem) {
+		item.Done = status
+	})
+}
+
+func (r *TodoItemMemory) GetChanges(ctx context.Context, userID int, sinceRevision int64,
+	limit int) ([]models.SyncItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var items []models.SyncItem
+	for _, m := range r.items {
+		if m.userID == userID && m.item.Revision > sinceRevision {
+			items = append(items, m.item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Revision < items[j].Revision
+	})
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	return items, nil
+}
+
+func (r *TodoItemMemory) GetSyncItem(ctx context.Context, userID, itemID int) (models.SyncItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.items[itemID]
+	if !ok || m.userID != userID {
+		return models.SyncItem{}, gorm.ErrRecordNotFound
+	}
+
+	return m.item, nil
+}
+
+func (r *TodoItemMemory) GetSyncItemByClientID(ctx context.Context, userID int, clientID string) (models.SyncItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := r.findByClientID(userID, clientID)
+	if m == nil {
+		return models.SyncItem{}, gorm.ErrRecordNotFound
+	}
+
+	return m.item, nil
+}
+
+func (r *TodoItemMemory) ApplySyncChange(ctx context.Context, userID int, item models.SyncItem,
+	baseVersion int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.items[item.ID]
+	if !ok || m.userID != userID || m.item.Version != baseVersion {
+		return false, nil
+	}
+
+	m.item.Title = item.Title
+	m.item.Description = item.Description
+	m.item.Done = item.Done
+	m.item.IsRemoved = item.IsRemoved
+	r.bump(&m.item)
+
+	return true, nil
+}
+
+// update applies fn to the user's item, if there is one, and bumps it.
+func (r *TodoItemMemory) update(userID, itemID int, fn func(item *models.SyncItem)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.items[itemID]
+	if !ok || m.userID != userID || m.item.IsRemoved {
+		return gorm.ErrRecordNotFound
+	}
+
+	fn(&m.item)
+	r.bump(&m.item)
+	return nil
+}
+
+func (r *TodoItemMemory) bump(item *models.SyncItem) {
+	r.revision++
+	item.Version++
+	item.Revision = r.revision
+	item.UpdatedAt = time.Now()
+}
+
+func (r *TodoItemMemory) findByClientID(userID int, clientID string) *memoryItem {
+	for _, m := range r.items {
+		if m.userID == userID && m.item.ClientID == clientID {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func toTodoItem(item models.SyncItem) models.TodoItem {
+	return models.TodoItem{
+		ID:          item.ID,
+		Title:       item.Title,
+		Description: item.Description,
+		Done:        item.Done,
+	}
+}
@@ -1,63 +1,106 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"github.com/NekruzRakhimov/todo_app/models"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"sync/atomic"
 )
 
 type TodoItemPostgres struct {
 	db *gorm.DB
+	// replicas serve GetAll and GetByID in turn; reads fall back to db when
+	// there are none or the replica fails.
+	replicas []*gorm.DB
+	next     uint32
 }
 
-func NewTodoItemPostgres(db *gorm.DB) *TodoItemPostgres {
-	return &TodoItemPostgres{db: db}
+func NewTodoItemPostgres(db *gorm.DB, replicas ...*gorm.DB) *TodoItemPostgres {
+	return &TodoItemPostgres{db: db, replicas: replicas}
 }
 
-func (r *TodoItemPostgres) Create(item models.TodoItem) (int, error) {
+// read runs query against the next replica, or the primary if there is no
+// replica or the replica fails.
+func (r *TodoItemPostgres) read(ctx context.Context, query func(db *gorm.DB) error) error {
+	if len(r.replicas) == 0 {
+		return query(r.db.WithContext(ctx))
+	}
+
+	replica := r.replicas[int(atomic.AddUint32(&r.next, 1)-1)%len(r.replicas)]
+	err := query(replica.WithContext(ctx))
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	logrus.Warnf("read replica failed, using the primary: %s", err)
+	return query(r.db.WithContext(ctx))
+}
+
+func (r *TodoItemPostgres) Create(ctx context.Context, item models.TodoItem) (int, error) {
 	var itemID int
 	fmt.Printf("create_item: %#v", item)
-	createItemQuery := "INSERT INTO todo_items (title, description, user_id) values ($1, $2, $3) RETURNING id"
-	if err := r.db.Table(todoItemsTable).Exec(createItemQuery, item.Title, item.Description, item.UserID).Pluck("id", &itemID).Error; err != nil {
+	createItemQuery := `INSERT INTO todo_items (title, description, done, user_id, client_id)
+						values ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id`
+	if err := r.db.WithContext(ctx).Raw(createItemQuery, item.Title, item.Description, item.Done, item.UserID, item.ClientID).Scan(&itemID).Error; err != nil {
 		return 0, err
 	}
 
 	return itemID, nil
 }
 
-func (r *TodoItemPostgres) BulkCreate(userID int, items []models.TodoItem) error {
-	for _, item := range items {
-		item.UserID = userID
-		id, err := r.Create(item)
-		if err != nil {
-			return err
+// BulkCreate creates all items or none. Inside WithinTx the transaction
+// becomes a savepoint of the outer one.
+func (r *TodoItemPostgres) BulkCreate(ctx context.Context, userID int, items []models.TodoItem) (ids []int, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := NewTodoItemPostgres(tx)
+		ids = make([]int, 0, len(items))
+		for _, item := range items {
+			item.UserID = userID
+			id, err := txRepo.Create(ctx, item)
+			if err != nil {
+				return err
+			}
+			logrus.Printf("Created todoItem with id=%d\n", id)
+			ids = append(ids, id)
 		}
-		logrus.Printf("Created todoItem with id=%d\n", id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return ids, nil
 }
 
-func (r *TodoItemPostgres) GetAll(userID int) (items []models.TodoItem, err error) {
+func (r *TodoItemPostgres) GetAll(ctx context.Context, userID int) (items []models.TodoItem, err error) {
 	sqlQuery := `SELECT ti.id, ti.title, ti.description, ti.done
 									FROM todo_items ti INNER JOIN users u
 									on ti.user_id = u.id
-									WHERE ti.user_id = ? AND ti.is_removed= false`
-	if err = r.db.Raw(sqlQuery, userID).Scan(&items).Error; err != nil {
+									WHERE ti.user_id = ? AND ti.is_removed= false
+									ORDER BY ti.id`
+	err = r.read(ctx, func(db *gorm.DB) error {
+		items = nil
+		return db.Raw(sqlQuery, userID).Scan(&items).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return items, nil
 }
 
-func (r *TodoItemPostgres) GetByID(userID, itemID int) (item models.TodoItem, err error) {
+func (r *TodoItemPostgres) GetByID(ctx context.Context, userID, itemID int) (item models.TodoItem, err error) {
 	sqlQuery := `SELECT ti.id, ti.title, ti.description, ti.done
 					FROM todo_items ti
 							 INNER JOIN users u
 										on ti.user_id = u.id
 					WHERE ti.id = ? AND ti.user_id = ? AND ti.is_removed= false`
-	if err = r.db.Raw(sqlQuery, itemID, userID).Scan(&item).Error; err != nil {
+	err = r.read(ctx, func(db *gorm.DB) error {
+		return db.Raw(sqlQuery, itemID, userID).Scan(&item).Error
+	})
+	if err != nil {
 		return models.TodoItem{}, err
 	}
 
@@ -68,35 +111,133 @@ func (r *TodoItemPostgres) GetByID(userID, itemID int) (item models.TodoItem, er
 	return item, nil
 }
 
-func (r *TodoItemPostgres) Delete(userID, itemID int) error {
+func (r *TodoItemPostgres) Delete(ctx context.Context, userID, itemID int) error {
 	sqlQuery := `UPDATE todo_items ti
 				SET is_removed = ?
-				FROM users u
-				WHERE  ti.user_id = ?
-				  AND ti.id = ?`
+				WHERE ti.user_id = ?
+				  AND ti.id = ?
+				  AND ti.is_removed = false`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, true, userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
 
-	err := r.db.Exec(sqlQuery, true, userID, itemID).Error
-	return err
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
 }
 
-func (r *TodoItemPostgres) Update(userID, itemID int, input models.TodoItem) error {
+func (r *TodoItemPostgres) Update(ctx context.Context, userID, itemID int, input models.TodoItem) error {
 	sqlQuery := `UPDATE todo_items ti
 				SET title       = ?,
 					description = ?,
 					done        = ?
 				WHERE ti.user_id = ?
-				  AND ti.id = ?`
+				  AND ti.id = ?
+				  AND ti.is_removed = false`
 
-	err := r.db.Exec(sqlQuery, input.Title, input.Description, input.Done, userID, itemID).Error
-	return err
+	result := r.db.WithContext(ctx).Exec(sqlQuery, input.Title, input.Description, input.Done, userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
 }
 
-func (r *TodoItemPostgres) ChangeStatus(userID, itemID int, status bool) error {
+func (r *TodoItemPostgres) ChangeStatus(ctx context.Context, userID, itemID int, status bool) error {
 	sqlQuery := `UPDATE todo_items ti
 					SET done = ?
 					WHERE ti.user_id = ?
-					  AND ti.id = ?`
+					  AND ti.id = ?
+					  AND ti.is_removed = false`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, status, userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetChanges relies on the revisions of one user being committed in order,
+// which the revision trigger ensures, so nothing is committed later below
+// the last revision returned.
+func (r *TodoItemPostgres) GetChanges(ctx context.Context, userID int, sinceRevision int64,
+	limit int) (items []models.SyncItem, err error) {
+	sqlQuery := `SELECT id, COALESCE(client_id, '') AS client_id, title, COALESCE(description, '') AS description,
+						done, is_removed, version, revision, updated_at
+					FROM todo_items
+					WHERE user_id = ? AND revision > ?
+					ORDER BY revision
+					LIMIT ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, sinceRevision, limit).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *TodoItemPostgres) GetSyncItem(ctx context.Context, userID, itemID int) (item models.SyncItem, err error) {
+	sqlQuery := `SELECT id, COALESCE(client_id, '') AS client_id, title, COALESCE(description, '') AS description,
+						done, is_removed, version, revision, updated_at
+					FROM todo_items
+					WHERE user_id = ? AND id = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, itemID).Scan(&item).Error; err != nil {
+		return models.SyncItem{}, err
+	}
+
+	if item.ID == 0 {
+		return models.SyncItem{}, gorm.ErrRecordNotFound
+	}
+
+	return item, nil
+}
+
+func (r *TodoItemPostgres) GetSyncItemByClientID(ctx context.Context, userID int,
+	clientID string) (item models.SyncItem, err error) {
+	sqlQuery := `SELECT id, COALESCE(client_id, '') AS client_id, title, COALESCE(description, '') AS description,
+						done, is_removed, version, revision, updated_at
+					FROM todo_items
+					WHERE user_id = ? AND client_id = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, clientID).Scan(&item).Error; err != nil {
+		return models.SyncItem{}, err
+	}
+
+	if item.ID == 0 {
+		return models.SyncItem{}, gorm.ErrRecordNotFound
+	}
+
+	return item, nil
+}
+
+// ApplySyncChange writes the item only if it is still at baseVersion and
+// reports whether it did.
+func (r *TodoItemPostgres) ApplySyncChange(ctx context.Context, userID int, item models.SyncItem,
+	baseVersion int) (bool, error) {
+	sqlQuery := `UPDATE todo_items ti
+				SET title       = ?,
+					description = ?,
+					done        = ?,
+					is_removed  = ?
+				WHERE ti.user_id = ?
+				  AND ti.id = ?
+				  AND ti.version = ?`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, item.Title, item.Description, item.Done, item.IsRemoved, userID, item.ID, baseVersion)
+	if result.Error != nil {
+		return false, result.Error
+	}
 
-	err := r.db.Exec(sqlQuery, status, userID, itemID).Error
-	return err
+	return result.RowsAffected == 1, nil
 }
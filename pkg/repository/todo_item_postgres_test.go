@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/migrate"
+	"github.com/NekruzRakhimov/todo_app/schema"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+// postgresTestURL names the variable holding the URL of a database the
+// Postgres tests may migrate and write to. They are skipped when it is unset.
+const postgresTestURL = "TODO_TEST_POSTGRES_URL"
+
+// openTestPostgres connects to the test database and migrates it to the
+// latest version.
+func openTestPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	url := os.Getenv(postgresTestURL)
+	if url == "" {
+		t.Skipf("%s is not set", postgresTestURL)
+	}
+
+	db, err := NewPostgresDB(Config{URL: url, ConnectTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = PostgresCloseConnection(db) })
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	migrator, err := migrate.New(sqlDB, schema.Migrations)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+
+	return db
+}
+
+// createTestUser adds a user that is deleted, with its items, when the
+// test ends.
+func createTestUser(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+
+	userID, err := NewAuthPostgres(db).CreateUser(context.Background(), models.User{
+		Name:     "Test",
+		Username: fmt.Sprintf("test_%d", time.Now().UnixNano()),
+		Password: "hash",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = ?`, userID) })
+
+	return userID
+}
+
+func TestTodoItemPostgres_GetChangesAfterOutOfOrderCommits(t *testing.T) {
+	db := openTestPostgres(t)
+	ctx := context.Background()
+	userID := createTestUser(t, db)
+	repo := NewTodoItemPostgres(db)
+
+	firstID, err := repo.Create(ctx, models.TodoItem{Title: "first", UserID: userID})
+	require.NoError(t, err)
+	secondID, err := repo.Create(ctx, models.TodoItem{Title: "second", UserID: userID})
+	require.NoError(t, err)
+
+	changes, err := repo.GetChanges(ctx, userID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	since := changes[1].Revision
+
+	// the first write takes its revision and stays uncommitted
+	first := db.Begin()
+	defer first.Rollback()
+	require.NoError(t, NewTodoItemPostgres(first).ChangeStatus(ctx, userID, firstID, true))
+
+	// the second write tries to commit meanwhile
+	secondDone := make(chan error, 1)
+	go func() {
+		secondDone <- db.Transaction(func(tx *gorm.DB) error {
+			return NewTodoItemPostgres(tx).ChangeStatus(ctx, userID, secondID, true)
+		})
+	}()
+
+	secondCommitted := false
+	select {
+	case err = <-secondDone:
+		require.NoError(t, err)
+		secondCommitted = true
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// a client syncing now must not get a token past the uncommitted write
+	changes, err = repo.GetChanges(ctx, userID, since, 100)
+	require.NoError(t, err)
+	for _, item := range changes {
+		since = item.Revision
+	}
+
+	require.NoError(t, first.Commit().Error)
+	if !secondCommitted {
+		select {
+		case err = <-secondDone:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("second write didn't commit")
+		}
+	}
+
+	changes, err = repo.GetChanges(ctx, userID, since, 100)
+	require.NoError(t, err)
+	seen := map[int]bool{}
+	for _, item := range changes {
+		seen[item.ID] = true
+	}
+
+	require.True(t, seen[firstID], "the write committed last was skipped by the sync token")
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	sqliteSyncItemColumns = `id, COALESCE(client_id, '') AS client_id, title, COALESCE(description, '') AS description,
+						done, is_removed, version, revision, updated_at`
+	// sqliteNextRevision stands in for the Postgres revision sequence; SQLite
+	// runs one write at a time, so the maximum only ever grows.
+	sqliteNextRevision = `(SELECT COALESCE(MAX(revision), 0) + 1 FROM todo_items)`
+	// sqliteBump does what the Postgres trigger does on every update.
+	sqliteBump = `version = version + 1, revision = ` + sqliteNextRevision + `, updated_at = ?`
+)
+
+type TodoItemSQLite struct {
+	db *gorm.DB
+}
+
+func NewTodoItemSQLite(db *gorm.DB) *TodoItemSQLite {
+	return &TodoItemSQLite{db: db}
+}
+
+func (r *TodoItemSQLite) Create(ctx context.Context, item models.TodoItem) (itemID int, err error) {
+	now := time.Now().UTC()
+	sqlQuery := `INSERT INTO todo_items (title, description, done, user_id, client_id, revision, created_at, updated_at)
+					VALUES (?, ?, ?, ?, NULLIF(?, ''), ` + sqliteNextRevision + `, ?, ?) RETURNING id`
+	err = r.db.WithContext(ctx).Raw(sqlQuery, item.Title, item.Description, item.Done, item.UserID, item.ClientID, now, now).
+		Scan(&itemID).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return itemID, nil
+}
+
+func (r *TodoItemSQLite) BulkCreate(ctx context.Context, userID int, items []models.TodoItem) (ids []int, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := NewTodoItemSQLite(tx)
+		ids = make([]int, 0, len(items))
+		for _, item := range items {
+			item.UserID = userID
+			id, err := txRepo.Create(ctx, item)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r *TodoItemSQLite) GetAll(ctx context.Context, userID int) (items []models.TodoItem, err error) {
+	sqlQuery := `SELECT id, title, COALESCE(description, '') AS description, done
+					FROM todo_items
+					WHERE user_id = ? AND is_removed = false
+					ORDER BY id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *TodoItemSQLite) GetByID(ctx context.Context, userID, itemID int) (item models.TodoItem, err error) {
+	sqlQuery := `SELECT id, title, COALESCE(description, '') AS description, done
+					FROM todo_items
+					WHERE id = ? AND user_id = ? AND is_removed = false`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, itemID, userID).Scan(&item).Error; err != nil {
+		return models.TodoItem{}, err
+	}
+
+	if item.ID == 0 {
+		return models.TodoItem{}, gorm.ErrRecordNotFound
+	}
+
+	return item, nil
+}
+
+func (r *TodoItemSQLite) Delete(ctx context.Context, userID, itemID int) error {
+	sqlQuery := `UPDATE todo_items SET is_removed = true, ` + sqliteBump + ` WHERE user_id = ? AND id = ? AND is_removed = false`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, time.Now().UTC(), userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *TodoItemSQLite) Update(ctx context.Context, userID, itemID int, input models.TodoItem) error {
+	sqlQuery := `UPDATE todo_items SET title = ?, description = ?, done = ?, ` + sqliteBump + `
+					WHERE user_id = ? AND id = ? AND is_removed = false`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, input.Title, input.Description, input.Done, time.Now().UTC(),
+		userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *TodoItemSQLite) ChangeStatus(ctx context.Context, userID, itemID int, status bool) error {
+	sqlQuery := `UPDATE todo_items SET done = ?, ` + sqliteBump + ` WHERE user_id = ? AND id = ? AND is_removed = false`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, status, time.Now().UTC(), userID, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *TodoItemSQLite) GetChanges(ctx context.Context, userID int, sinceRevision int64,
+	limit int) (items []models.SyncItem, err error) {
+	sqlQuery := `SELECT ` + sqliteSyncItemColumns + `
+					FROM todo_items
+					WHERE user_id = ? AND revision > ?
+					ORDER BY revision
+					LIMIT ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, sinceRevision, limit).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *TodoItemSQLite) GetSyncItem(ctx context.Context, userID, itemID int) (models.SyncItem, error) {
+	return r.getSyncItem(ctx, `user_id = ? AND id = ?`, userID, itemID)
+}
+
+func (r *TodoItemSQLite) GetSyncItemByClientID(ctx context.Context, userID int, clientID string) (models.SyncItem, error) {
+	return r.getSyncItem(ctx, `user_id = ? AND client_id = ?`, userID, clientID)
+}
+
+// ApplySyncChange writes the item only if it is still at baseVersion and
+// reports whether it did.
+func (r *TodoItemSQLite) ApplySyncChange(ctx context.Context, userID int, item models.SyncItem,
+	baseVersion int) (bool, error) {
+	sqlQuery := `UPDATE todo_items SET title = ?, description = ?, done = ?, is_removed = ?, ` + sqliteBump + `
+					WHERE user_id = ? AND id = ? AND version = ?`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, item.Title, item.Description, item.Done, item.IsRemoved, time.Now().UTC(),
+		userID, item.ID, baseVersion)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r *TodoItemSQLite) getSyncItem(ctx context.Context, where string,
+	args ...interface{}) (item models.SyncItem, err error) {
+	sqlQuery := `SELECT ` + sqliteSyncItemColumns + ` FROM todo_items WHERE ` + where
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, args...).Scan(&item).Error; err != nil {
+		return models.SyncItem{}, err
+	}
+
+	if item.ID == 0 {
+		return models.SyncItem{}, gorm.ErrRecordNotFound
+	}
+
+	return item, nil
+}
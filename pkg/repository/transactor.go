@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// txMaxAttempts bounds how often a transaction is run when it keeps
+	// failing with a serialization failure or deadlock.
+	txMaxAttempts  = 3
+	txRetryBackoff = 20 * time.Millisecond
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// gormTransactor runs transactions on db. bind returns the repositories to
+// hand to fn, backed by the transaction.
+type gormTransactor struct {
+	db   *gorm.DB
+	bind func(tx *gorm.DB) *Repository
+}
+
+func (t *gormTransactor) WithinTx(ctx context.Context, fn func(repos *Repository) error) error {
+	run := func() error {
+		return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(t.bind(tx))
+		})
+	}
+
+	// a nested call becomes a savepoint; retrying it is pointless, the
+	// failure aborts the outer transaction
+	if committer, ok := t.db.Statement.ConnPool.(gorm.TxCommitter); ok && committer != nil {
+		return run()
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = run()
+		if err == nil || attempt == txMaxAttempts || !isRetryableTxError(err) {
+			return err
+		}
+
+		backoff := txRetryBackoff << (attempt - 1)
+		backoff += time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func isRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+	}
+
+	return strings.Contains(err.Error(), "database is locked")
+}
+
+// snapshotter is implemented by the in-memory stores. restore puts back the
+// state taken by snapshot; like Postgres sequences, ids and revisions handed
+// out in between are not reused.
+type snapshotter interface {
+	snapshot() (restore func())
+}
+
+// memoryTransactor runs transactions on the in-memory repositories one at a
+// time, restoring the users and items if fn fails. There is no isolation:
+// other callers see the writes before fn returns, and a rollback also undoes
+// what they wrote meanwhile.
+type memoryTransactor struct {
+	mu    *sync.Mutex
+	repos *Repository
+	// nested is set on the transactor handed to fn, which doesn't lock again.
+	nested bool
+}
+
+func newMemoryTransactor(repos *Repository) *memoryTransactor {
+	return &memoryTransactor{mu: new(sync.Mutex), repos: repos}
+}
+
+func (t *memoryTransactor) WithinTx(ctx context.Context, fn func(repos *Repository) error) error {
+	if !t.nested {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+	}
+
+	var restores []func()
+	for _, store := range []interface{}{t.repos.Authorization, t.repos.TodoItem} {
+		if s, ok := store.(snapshotter); ok {
+			restores = append(restores, s.snapshot())
+		}
+	}
+
+	txRepos := *t.repos
+	txRepos.Transactor = &memoryTransactor{mu: t.mu, repos: &txRepos, nested: true}
+	if err := fn(&txRepos); err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+)
+
+type TwoFactorPostgres struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorPostgres(db *gorm.DB) *TwoFactorPostgres {
+	return &TwoFactorPostgres{db: db}
+}
+
+func (r *TwoFactorPostgres) Get(ctx context.Context, userID int) (tf models.TwoFactor, err error) {
+	sqlQuery := fmt.Sprintf(`SELECT id AS user_id, COALESCE(totp_secret, '') AS totp_secret, totp_enabled, totp_last_step
+					FROM %s WHERE id = $1`, usersTable)
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&tf).Error; err != nil {
+		return models.TwoFactor{}, err
+	}
+
+	if tf.UserID == 0 {
+		return models.TwoFactor{}, gorm.ErrRecordNotFound
+	}
+
+	return tf, nil
+}
+
+func (r *TwoFactorPostgres) SetSecret(ctx context.Context, userID int, secret string) error {
+	sqlQuery := fmt.Sprintf(`UPDATE %s SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled = false`, usersTable)
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, secret, userID).Error
+	return err
+}
+
+func (r *TwoFactorPostgres) Enable(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sqlQuery := fmt.Sprintf(`UPDATE %s SET totp_enabled = true, totp_last_step = $1 WHERE id = $2`, usersTable)
+		if err := tx.Exec(sqlQuery, step, userID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID).Error; err != nil {
+			return err
+		}
+
+		for _, hash := range codeHashes {
+			if err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *TwoFactorPostgres) Disable(ctx context.Context, userID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sqlQuery := fmt.Sprintf(
+			`UPDATE %s SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0 WHERE id = $1`, usersTable)
+		if err := tx.Exec(sqlQuery, userID).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID).Error
+	})
+}
+
+func (r *TwoFactorPostgres) UpdateLastStep(ctx context.Context, userID int, step int64) (bool, error) {
+	sqlQuery := fmt.Sprintf(`UPDATE %s SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`, usersTable)
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, step, userID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r *TwoFactorPostgres) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	sqlQuery := `UPDATE recovery_codes
+					SET used_at = now()
+					WHERE user_id = ?
+					  AND code_hash = ?
+					  AND used_at IS NULL`
+
+	result := r.db.WithContext(ctx).Exec(sqlQuery, userID, codeHash)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrNotSupported is returned by features the configured storage backend
+// doesn't implement. Only Postgres has them all.
+var ErrNotSupported = errors.New("not supported by this storage backend")
+
+// The unsupported* types fill the Repository fields the SQLite and in-memory
+// backends lack. Reads that other features depend on report "nothing there",
+// so webhooks never fire, 2FA is off and no access token is valid.
+
+type unsupportedWebhook struct{}
+
+func (unsupportedWebhook) Create(context.Context, models.Webhook) (int, error) {
+	return 0, ErrNotSupported
+}
+func (unsupportedWebhook) GetAll(context.Context, int) ([]models.Webhook, error) {
+	return nil, ErrNotSupported
+}
+func (unsupportedWebhook) GetByID(context.Context, int, int) (models.Webhook, error) {
+	return models.Webhook{}, ErrNotSupported
+}
+func (unsupportedWebhook) GetActiveByEvent(context.Context, int, string) ([]models.Webhook, error) {
+	return nil, nil
+}
+func (unsupportedWebhook) Delete(context.Context, int, int) error { return ErrNotSupported }
+func (unsupportedWebhook) CreateDelivery(context.Context, models.WebhookDelivery) (int, error) {
+	return 0, ErrNotSupported
+}
+func (unsupportedWebhook) GetActiveByID(context.Context, int) (models.Webhook, error) {
+	return models.Webhook{}, ErrNotSupported
+}
+func (unsupportedWebhook) UpdateDelivery(context.Context, models.WebhookDelivery) error {
+	return ErrNotSupported
+}
+func (unsupportedWebhook) ClaimDueDeliveries(context.Context, int, time.Duration) ([]models.WebhookDelivery, error) {
+	return nil, nil
+}
+func (unsupportedWebhook) GetDeliveries(context.Context, int, int) ([]models.WebhookDelivery, error) {
+	return nil, ErrNotSupported
+}
+func (unsupportedWebhook) GetDeliveryByID(context.Context, int, int, int) (models.WebhookDelivery, error) {
+	return models.WebhookDelivery{}, ErrNotSupported
+}
+
+type unsupportedUserToken struct{}
+
+func (unsupportedUserToken) Create(context.Context, int, string, string, time.Duration) error {
+	return ErrNotSupported
+}
+func (unsupportedUserToken) Consume(context.Context, string, string) (int, error) {
+	return 0, gorm.ErrRecordNotFound
+}
+func (unsupportedUserToken) DeleteByUser(context.Context, int, string) error { return ErrNotSupported }
+
+type unsupportedTwoFactor struct{}
+
+func (unsupportedTwoFactor) Get(ctx context.Context, userID int) (models.TwoFactor, error) {
+	return models.TwoFactor{UserID: userID}, nil
+}
+func (unsupportedTwoFactor) SetSecret(context.Context, int, string) error { return ErrNotSupported }
+func (unsupportedTwoFactor) Enable(context.Context, int, int64, []string) error {
+	return ErrNotSupported
+}
+func (unsupportedTwoFactor) Disable(context.Context, int) error { return ErrNotSupported }
+func (unsupportedTwoFactor) UpdateLastStep(context.Context, int, int64) (bool, error) {
+	return false, ErrNotSupported
+}
+func (unsupportedTwoFactor) UseRecoveryCode(context.Context, int, string) (bool, error) {
+	return false, ErrNotSupported
+}
+
+type unsupportedAccessToken struct{}
+
+func (unsupportedAccessToken) Create(context.Context, models.PersonalAccessToken, string, time.Duration) (models.PersonalAccessToken, error) {
+	return models.PersonalAccessToken{}, ErrNotSupported
+}
+func (unsupportedAccessToken) GetAll(context.Context, int) ([]models.PersonalAccessToken, error) {
+	return nil, ErrNotSupported
+}
+func (unsupportedAccessToken) GetActiveByHash(context.Context, string) (models.PersonalAccessToken, error) {
+	return models.PersonalAccessToken{}, gorm.ErrRecordNotFound
+}
+func (unsupportedAccessToken) Revoke(context.Context, int, int) error { return ErrNotSupported }
+func (unsupportedAccessToken) Touch(context.Context, int, time.Duration) error {
+	return ErrNotSupported
+}
+
+type unsupportedAdmin struct{}
+
+func (unsupportedAdmin) ListUsers(context.Context, string, int, int) ([]models.AdminUser, int, error) {
+	return nil, 0, ErrNotSupported
+}
+func (unsupportedAdmin) GetUser(context.Context, int) (models.AdminUser, error) {
+	return models.AdminUser{}, ErrNotSupported
+}
+func (unsupportedAdmin) SetDisabled(context.Context, int, bool) error { return ErrNotSupported }
+func (unsupportedAdmin) DeleteUser(context.Context, int) error        { return ErrNotSupported }
+
+type unsupportedProfile struct{}
+
+func (unsupportedProfile) Get(context.Context, int) (models.Profile, error) {
+	return models.Profile{}, ErrNotSupported
+}
+func (unsupportedProfile) Update(context.Context, int, models.ProfileUpdateInput) error {
+	return ErrNotSupported
+}
+func (unsupportedProfile) ScheduleDeletion(context.Context, int, time.Duration) (time.Time, error) {
+	return time.Time{}, ErrNotSupported
+}
+func (unsupportedProfile) CancelDeletion(context.Context, int) error      { return ErrNotSupported }
+func (unsupportedProfile) DeleteScheduled(context.Context) ([]int, error) { return nil, nil }
+
+type unsupportedExport struct{}
+
+func (unsupportedExport) Create(context.Context, int) (models.DataExport, error) {
+	return models.DataExport{}, ErrNotSupported
+}
+func (unsupportedExport) GetByID(context.Context, int) (models.DataExport, error) {
+	return models.DataExport{}, ErrNotSupported
+}
+func (unsupportedExport) GetAll(context.Context, int) ([]models.DataExport, error) {
+	return nil, ErrNotSupported
+}
+func (unsupportedExport) GetPending(context.Context, int, time.Duration) (models.DataExport, error) {
+	return models.DataExport{}, ErrNotSupported
+}
+func (unsupportedExport) MarkReady(context.Context, int, string, time.Duration) error {
+	return ErrNotSupported
+}
+func (unsupportedExport) MarkFailed(context.Context, int, string) error           { return ErrNotSupported }
+func (unsupportedExport) GetExpired(context.Context) ([]models.DataExport, error) { return nil, nil }
+func (unsupportedExport) Delete(context.Context, int) error                       { return ErrNotSupported }
+func (unsupportedExport) GetItems(context.Context, int) ([]models.ExportItem, error) {
+	return nil, ErrNotSupported
+}
+func (unsupportedExport) GetAuthHistory(context.Context, int) ([]models.AuthAuditEntry, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+type UserTokenPostgres struct {
+	db *gorm.DB
+}
+
+func NewUserTokenPostgres(db *gorm.DB) *UserTokenPostgres {
+	return &UserTokenPostgres{db: db}
+}
+
+func (r *UserTokenPostgres) Create(ctx context.Context, userID int, purpose, tokenHash string, ttl time.Duration) error {
+	sqlQuery := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+					VALUES (?, ?, ?, now() + make_interval(secs => ?))`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, userID, purpose, tokenHash, ttl.Seconds()).Error
+	return err
+}
+
+func (r *UserTokenPostgres) Consume(ctx context.Context, purpose, tokenHash string) (userID int, err error) {
+	sqlQuery := `UPDATE user_tokens
+					SET used_at = now()
+					WHERE purpose = ?
+					  AND token_hash = ?
+					  AND used_at IS NULL
+					  AND expires_at > now()
+					RETURNING user_id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, purpose, tokenHash).Scan(&userID).Error; err != nil {
+		return 0, err
+	}
+
+	if userID == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return userID, nil
+}
+
+func (r *UserTokenPostgres) DeleteByUser(ctx context.Context, userID int, purpose string) error {
+	sqlQuery := `DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, userID, purpose).Error
+	return err
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"time"
+)
+
+type WebhookPostgres struct {
+	db *gorm.DB
+}
+
+func NewWebhookPostgres(db *gorm.DB) *WebhookPostgres {
+	return &WebhookPostgres{db: db}
+}
+
+type webhookRow struct {
+	ID        int
+	UserID    int
+	URL       string
+	Secret    string
+	Events    pq.StringArray
+	IsActive  bool
+	CreatedAt time.Time
+}
+
+func (w webhookRow) toModel() models.Webhook {
+	return models.Webhook{
+		ID:        w.ID,
+		UserID:    w.UserID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    w.Events,
+		IsActive:  w.IsActive,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+func (r *WebhookPostgres) Create(ctx context.Context, webhook models.Webhook) (id int, err error) {
+	sqlQuery := `INSERT INTO webhooks (user_id, url, secret, events)
+					VALUES (?, ?, ?, ?) RETURNING id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.Events)).
+		Scan(&id).Error; err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *WebhookPostgres) GetAll(ctx context.Context, userID int) ([]models.Webhook, error) {
+	sqlQuery := `SELECT id, user_id, url, secret, events, is_active, created_at
+					FROM webhooks
+					WHERE user_id = ?
+					ORDER BY id`
+	var rows []webhookRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, userID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]models.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhooks = append(webhooks, row.toModel())
+	}
+
+	return webhooks, nil
+}
+
+func (r *WebhookPostgres) GetByID(ctx context.Context, userID, webhookID int) (models.Webhook, error) {
+	sqlQuery := `SELECT id, user_id, url, secret, events, is_active, created_at
+					FROM webhooks
+					WHERE id = ? AND user_id = ?`
+	var row webhookRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, webhookID, userID).Scan(&row).Error; err != nil {
+		return models.Webhook{}, err
+	}
+
+	if row.ID == 0 {
+		return models.Webhook{}, gorm.ErrRecordNotFound
+	}
+
+	return row.toModel(), nil
+}
+
+func (r *WebhookPostgres) GetActiveByEvent(ctx context.Context, userID int, event string) ([]models.Webhook, error) {
+	sqlQuery := `SELECT id, user_id, url, secret, events, is_active, created_at
+					FROM webhooks
+					WHERE user_id = ? AND is_active = true AND ? = ANY (events)`
+	var rows []webhookRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, userID, event).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]models.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhooks = append(webhooks, row.toModel())
+	}
+
+	return webhooks, nil
+}
+
+// GetActiveByID returns the webhook regardless of its owner, for retrying
+// deliveries in the background.
+func (r *WebhookPostgres) GetActiveByID(ctx context.Context, webhookID int) (models.Webhook, error) {
+	sqlQuery := `SELECT id, user_id, url, secret, events, is_active, created_at
+					FROM webhooks
+					WHERE id = ? AND is_active = true`
+	var row webhookRow
+	if err := r.db.WithContext(ctx).Raw(sqlQuery, webhookID).Scan(&row).Error; err != nil {
+		return models.Webhook{}, err
+	}
+
+	if row.ID == 0 {
+		return models.Webhook{}, gorm.ErrRecordNotFound
+	}
+
+	return row.toModel(), nil
+}
+
+func (r *WebhookPostgres) Delete(ctx context.Context, userID, webhookID int) error {
+	sqlQuery := `DELETE FROM webhooks WHERE user_id = ? AND id = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, userID, webhookID).Error
+	return err
+}
+
+func (r *WebhookPostgres) CreateDelivery(ctx context.Context, delivery models.WebhookDelivery) (id int, err error) {
+	sqlQuery := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at)
+					VALUES (?, ?, ?, ?, ?) RETURNING id`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, delivery.WebhookID, delivery.Event, delivery.Payload, delivery.Status,
+		delivery.NextAttemptAt).Scan(&id).Error; err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *WebhookPostgres) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	sqlQuery := `UPDATE webhook_deliveries
+					SET status          = ?,
+						attempts        = ?,
+						response_code   = ?,
+						last_error      = ?,
+						delivered_at    = ?,
+						next_attempt_at = ?
+					WHERE id = ?`
+
+	err := r.db.WithContext(ctx).Exec(sqlQuery, delivery.Status, delivery.Attempts, delivery.ResponseCode,
+		delivery.LastError, delivery.DeliveredAt, delivery.NextAttemptAt, delivery.ID).Error
+	return err
+}
+
+func (r *WebhookPostgres) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (deliveries []models.WebhookDelivery, err error) {
+	sqlQuery := `UPDATE webhook_deliveries
+					SET next_attempt_at = now() + make_interval(secs => ?)
+					WHERE id IN (SELECT id
+								 FROM webhook_deliveries
+								 WHERE status = ? AND next_attempt_at <= now()
+								 ORDER BY next_attempt_at
+								 LIMIT ? FOR UPDATE SKIP LOCKED)
+					RETURNING id, webhook_id, event, payload, status, attempts,
+						COALESCE(response_code, 0) AS response_code,
+						COALESCE(last_error, '')   AS last_error,
+						created_at, delivered_at, next_attempt_at`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, lease.Seconds(), models.DeliveryPending, limit).Scan(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookPostgres) GetDeliveries(ctx context.Context, userID, webhookID int) (deliveries []models.WebhookDelivery, err error) {
+	sqlQuery := `SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+						COALESCE(d.response_code, 0) AS response_code,
+						COALESCE(d.last_error, '')   AS last_error,
+						d.created_at, d.delivered_at, d.next_attempt_at
+					FROM webhook_deliveries d
+							 INNER JOIN webhooks w
+										ON d.webhook_id = w.id
+					WHERE w.user_id = ? AND w.id = ?
+					ORDER BY d.id DESC`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, webhookID).Scan(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookPostgres) GetDeliveryByID(ctx context.Context, userID, webhookID, deliveryID int) (delivery models.WebhookDelivery, err error) {
+	sqlQuery := `SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+						COALESCE(d.response_code, 0) AS response_code,
+						COALESCE(d.last_error, '')   AS last_error,
+						d.created_at, d.delivered_at, d.next_attempt_at
+					FROM webhook_deliveries d
+							 INNER JOIN webhooks w
+										ON d.webhook_id = w.id
+					WHERE w.user_id = ? AND w.id = ? AND d.id = ?`
+	if err = r.db.WithContext(ctx).Raw(sqlQuery, userID, webhookID, deliveryID).Scan(&delivery).Error; err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	if delivery.ID == 0 {
+		return models.WebhookDelivery{}, gorm.ErrRecordNotFound
+	}
+
+	return delivery, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from JWTs and found by secret scanners.
+const AccessTokenPrefix = "todo_pat_"
+
+const (
+	// accessTokenVisibleChars of the random part are kept to tell tokens apart in listings.
+	accessTokenVisibleChars = 6
+	// accessTokenTouchInterval limits how often using a token writes its last-used time.
+	accessTokenTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidAccessToken   = errors.New("invalid, expired or revoked access token")
+	ErrInvalidTokenName     = errors.New("token name is required")
+	ErrInvalidScope         = errors.New("invalid scope")
+	ErrInvalidTokenLifetime = errors.New("expires_in_days can't be negative")
+)
+
+// accessTokenScopes can be granted to personal access tokens. Account and
+// admin scopes are left out so a leaked token can't be used to take over the account.
+var accessTokenScopes = map[string]bool{
+	models.ScopeItemsRead:     true,
+	models.ScopeItemsWrite:    true,
+	models.ScopeWebhooksRead:  true,
+	models.ScopeWebhooksWrite: true,
+}
+
+type AccessTokenService struct {
+	repo repository.AccessToken
+}
+
+func NewAccessTokenService(repo repository.AccessToken) *AccessTokenService {
+	return &AccessTokenService{repo: repo}
+}
+
+// Create issues a token. The plain token is only returned here; just its
+// hash is stored.
+func (s *AccessTokenService) Create(ctx context.Context, userID int, input models.PersonalAccessTokenInput) (models.PersonalAccessToken, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > 255 {
+		return models.PersonalAccessToken{}, ErrInvalidTokenName
+	}
+
+	if len(input.Scopes) == 0 {
+		return models.PersonalAccessToken{}, ErrInvalidScope
+	}
+
+	for _, scope := range input.Scopes {
+		if !accessTokenScopes[scope] {
+			return models.PersonalAccessToken{}, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	if input.ExpiresInDays < 0 {
+		return models.PersonalAccessToken{}, ErrInvalidTokenLifetime
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+	plain := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token, err := s.repo.Create(ctx, models.PersonalAccessToken{
+		UserID: userID,
+		Name:   input.Name,
+		Prefix: plain[:len(AccessTokenPrefix)+accessTokenVisibleChars],
+		Scopes: input.Scopes,
+	}, hashToken(plain), time.Duration(input.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	token.Token = plain
+	return token, nil
+}
+
+func (s *AccessTokenService) GetAll(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	return s.repo.GetAll(ctx, userID)
+}
+
+func (s *AccessTokenService) Revoke(ctx context.Context, userID, tokenID int) error {
+	return s.repo.Revoke(ctx, userID, tokenID)
+}
+
+// Authenticate looks up an active token and records that it was used.
+func (s *AccessTokenService) Authenticate(ctx context.Context, plain string) (models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(plain, AccessTokenPrefix) {
+		return models.PersonalAccessToken{}, ErrInvalidAccessToken
+	}
+
+	token, err := s.repo.GetActiveByHash(ctx, hashToken(plain))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.PersonalAccessToken{}, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	if err = s.repo.Touch(ctx, token.ID, accessTokenTouchInterval); err != nil {
+		logrus.Errorf("couldn't update access token last used time: %s", err.Error())
+	}
+
+	return token, nil
+}
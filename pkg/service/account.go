@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/mailer"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	ErrNoEmail      = errors.New("account has no email address")
+)
+
+type AccountConfig struct {
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	// PasswordResetURL and VerifyEmailURL are prefixes the token is appended to in emails.
+	PasswordResetURL string
+	VerifyEmailURL   string
+}
+
+type AccountService struct {
+	users  repository.Authorization
+	tokens repository.UserToken
+	mailer mailer.Mailer
+	cfg    AccountConfig
+}
+
+func NewAccountService(users repository.Authorization, tokens repository.UserToken,
+	mailer mailer.Mailer, cfg AccountConfig) *AccountService {
+	return &AccountService{users: users, tokens: tokens, mailer: mailer, cfg: cfg}
+}
+
+// ForgotPassword mails a reset token if an account has the email. It reports
+// success either way so it can't be used to find out which emails are registered.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = s.tokens.DeleteByUser(ctx, user.ID, models.TokenPasswordReset); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, models.TokenPasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nTo reset your password open the link below. It expires in %s.\n\n%s%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			user.Name, s.cfg.PasswordResetTTL, s.cfg.PasswordResetURL, token),
+	})
+
+	return nil
+}
+
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	userID, err := s.tokens.Consume(ctx, models.TokenPasswordReset, hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = s.users.UpdatePassword(ctx, userID, generatePasswordHash(password)); err != nil {
+		return err
+	}
+
+	return s.tokens.DeleteByUser(ctx, userID, models.TokenPasswordReset)
+}
+
+// ForcePasswordReset replaces the user's password with a random one, so it
+// can't be used any more, and emails them a reset link.
+func (s *AccountService) ForcePasswordReset(ctx context.Context, userID int) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+
+	if err = s.users.UpdatePassword(ctx, userID, generatePasswordHash(base64.RawURLEncoding.EncodeToString(b))); err != nil {
+		return err
+	}
+
+	if err = s.tokens.DeleteByUser(ctx, user.ID, models.TokenPasswordReset); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, models.TokenPasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your password has been reset",
+		Body: fmt.Sprintf("Hi %s,\n\nAn administrator has reset the password of your account. "+
+			"To choose a new one open the link below. It expires in %s.\n\n%s%s\n",
+			user.Name, s.cfg.PasswordResetTTL, s.cfg.PasswordResetURL, token),
+	})
+
+	return nil
+}
+
+func (s *AccountService) SendVerificationEmail(ctx context.Context, userID int) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+
+	if err = s.tokens.DeleteByUser(ctx, user.ID, models.TokenEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, models.TokenEmailVerification, s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below.\n\n%s%s\n",
+			user.Name, s.cfg.VerifyEmailURL, token),
+	})
+
+	return nil
+}
+
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.tokens.Consume(ctx, models.TokenEmailVerification, hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.users.SetEmailVerified(ctx, userID)
+}
+
+// issueToken stores the hash of a new random token and returns the token itself.
+func (s *AccountService) issueToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := s.tokens.Create(ctx, userID, purpose, hashToken(token), ttl); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// send delivers the message in the background so response times don't reveal
+// whether an email was sent.
+func (s *AccountService) send(msg mailer.Message) {
+	go func() {
+		if err := s.mailer.Send(msg); err != nil {
+			logrus.Errorf("couldn't send %q email: %s", msg.Subject, err.Error())
+		}
+	}()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
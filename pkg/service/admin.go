@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+var ErrAdminSelfAction = errors.New("admins can't disable or delete their own account")
+
+type AdminService struct {
+	repo    repository.Admin
+	audit   repository.AuthAudit
+	tx      repository.Transactor
+	account *AccountService
+}
+
+func NewAdminService(repo repository.Admin, audit repository.AuthAudit, tx repository.Transactor,
+	account *AccountService) *AdminService {
+	return &AdminService{repo: repo, audit: audit, tx: tx, account: account}
+}
+
+func (s *AdminService) ListUsers(ctx context.Context, actorID int, ip, search string, limit, offset int) (models.AdminUserList, error) {
+	if limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	search = strings.TrimSpace(search)
+	users, total, err := s.repo.ListUsers(ctx, search, limit, offset)
+	if err != nil {
+		return models.AdminUserList{}, err
+	}
+
+	if users == nil {
+		users = []models.AdminUser{}
+	}
+
+	s.writeAudit(ctx, actorID, nil, "", ip, models.AuditAdminUsersListed,
+		fmt.Sprintf("search=%q limit=%d offset=%d", search, limit, offset))
+
+	return models.AdminUserList{Users: users, Total: total}, nil
+}
+
+func (s *AdminService) GetUser(ctx context.Context, actorID int, ip string, userID int) (models.AdminUser, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+
+	s.writeAudit(ctx, actorID, &user.ID, user.Username, ip, models.AuditAdminUserViewed, "")
+
+	return user, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabled users can't sign
+// in and their access tokens stop working. The change and its audit entry
+// are written together or not at all.
+func (s *AdminService) SetDisabled(ctx context.Context, actorID int, ip string, userID int, disabled bool) error {
+	if actorID == userID {
+		return ErrAdminSelfAction
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	event := models.AuditAdminUserEnabled
+	if disabled {
+		event = models.AuditAdminUserDisabled
+	}
+
+	return s.tx.WithinTx(ctx, func(repos *repository.Repository) error {
+		if err := repos.Admin.SetDisabled(ctx, userID, disabled); err != nil {
+			return err
+		}
+
+		return repos.AuthAudit.Log(ctx, adminAuditEntry(actorID, &user.ID, user.Username, ip, event, ""))
+	})
+}
+
+// DeleteUser deletes the account together with its audit entry.
+func (s *AdminService) DeleteUser(ctx context.Context, actorID int, ip string, userID int) error {
+	if actorID == userID {
+		return ErrAdminSelfAction
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(repos *repository.Repository) error {
+		if err := repos.Admin.DeleteUser(ctx, userID); err != nil {
+			return err
+		}
+
+		// the user row is gone, so the entry keeps only the username and id
+		return repos.AuthAudit.Log(ctx, adminAuditEntry(actorID, nil, user.Username, ip, models.AuditAdminUserDeleted,
+			fmt.Sprintf("user id %d, %d items", user.ID, user.ItemCount)))
+	})
+}
+
+// ForcePasswordReset invalidates the user's password and emails them a reset link.
+func (s *AdminService) ForcePasswordReset(ctx context.Context, actorID int, ip string, userID int) error {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.account.ForcePasswordReset(ctx, userID); err != nil {
+		return err
+	}
+
+	s.writeAudit(ctx, actorID, &user.ID, user.Username, ip, models.AuditAdminPasswordReset, "")
+
+	return nil
+}
+
+// writeAudit records an admin action, only logging a failure.
+func (s *AdminService) writeAudit(ctx context.Context, actorID int, userID *int, username, ip, event, details string) {
+	err := s.audit.Log(ctx, adminAuditEntry(actorID, userID, username, ip, event, details))
+	if err != nil {
+		logrus.Errorf("couldn't write auth audit log: %s", err.Error())
+	}
+}
+
+// adminAuditEntry describes an admin action. actorID 0 stands for an
+// operator using the command line, who has no account.
+func adminAuditEntry(actorID int, userID *int, username, ip, event, details string) models.AuthAuditEntry {
+	var actor *int
+	if actorID != 0 {
+		actor = &actorID
+	}
+
+	return models.AuthAuditEntry{
+		UserID:   userID,
+		ActorID:  actor,
+		Username: username,
+		IP:       ip,
+		Event:    event,
+		Details:  details,
+	}
+}
@@ -1,74 +1,447 @@
 package service
 
 import (
+	"context"
 	"crypto/sha1"
 	"errors"
 	"fmt"
 	"github.com/NekruzRakhimov/todo_app/models"
 	"github.com/NekruzRakhimov/todo_app/pkg/repository"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
+const salt = "hjqrhjqw124617ajfhajs"
+
 const (
-	salt       = "hjqrhjqw124617ajfhajs"
-	signingKey = "qrkjk#4#%35FSFJlja#4353KSFjH"
-	tokenTTL   = 12 * time.Hour
+	twoFactorChallengePurpose = "2fa_challenge"
+	streamPurpose             = "stream"
+	// streamTokenTTL only has to cover opening the stream; a stream that is
+	// already open isn't closed when its token expires.
+	streamTokenTTL = time.Minute
 )
 
 type tokenClaims struct {
 	jwt.StandardClaims
-	UserID int `json:"user_id"`
+	UserID  int      `json:"user_id"`
+	Purpose string   `json:"purpose,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrTwoFactorRequired  = errors.New("two-factor authentication is required")
+	ErrInvalidChallenge   = errors.New("invalid or expired two-factor challenge")
+	ErrAccountDisabled    = errors.New("account is disabled")
+	// ErrUsernameTaken and ErrEmailTaken come from the unique indexes in the repository.
+	ErrUsernameTaken = repository.ErrUsernameTaken
+	ErrEmailTaken    = repository.ErrEmailTaken
+)
+
+// LoginLockedError is returned while a username or IP is locked out after too many failed logins.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+type TokenConfig struct {
+	// SigningKey signs the access and two-factor challenge JWTs.
+	SigningKey []byte
+	// TTL is how long access tokens are valid for.
+	TTL time.Duration
+}
+
+type LockoutConfig struct {
+	// MaxFailures failed logins for a username within FailureWindow lock it.
+	MaxFailures int
+	// MaxIPFailures failed logins from an IP within FailureWindow lock the IP.
+	MaxIPFailures int
+	FailureWindow time.Duration
+	// LockoutDuration doubles with every consecutive lockout, up to MaxLockoutDuration.
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+	// BaseDelay doubles with every consecutive failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
 }
 
 type AuthService struct {
-	repo repository.Authorization
+	repo      repository.Authorization
+	attempts  repository.LoginAttempt
+	audit     repository.AuthAudit
+	twoFactor *TwoFactorService
+	tokens    TokenConfig
+	lockout   LockoutConfig
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo repository.Authorization, attempts repository.LoginAttempt,
+	audit repository.AuthAudit, twoFactor *TwoFactorService, tokens TokenConfig, lockout LockoutConfig) *AuthService {
+	return &AuthService{repo: repo, attempts: attempts, audit: audit, twoFactor: twoFactor, tokens: tokens, lockout: lockout}
 }
 
-func (s *AuthService) CreateUser(user models.User) (int, error) {
+func (s *AuthService) CreateUser(ctx context.Context, user models.User) (int, error) {
+	user.Username = normalizeUsername(user.Username)
 	user.Password = generatePasswordHash(user.Password)
-	return s.repo.CreateUser(user)
+	return s.repo.CreateUser(ctx, user)
+}
+
+// normalizeUsername is applied wherever a username comes in, so sign-up, the
+// availability check and sign-in agree on what the unique index compares.
+func normalizeUsername(username string) string {
+	return strings.TrimSpace(username)
+}
+
+// UsernameAvailable reports whether no account has the username, ignoring case.
+func (s *AuthService) UsernameAvailable(ctx context.Context, username string) (bool, error) {
+	exists, err := s.repo.UsernameExists(ctx, normalizeUsername(username))
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// GenerateToken checks the credentials and issues an access token. It fails
+// with ErrTwoFactorRequired for accounts with 2FA, which must use SignIn.
+func (s *AuthService) GenerateToken(ctx context.Context, username, password, ip string) (string, error) {
+	result, err := s.SignIn(ctx, username, password, ip)
+	if err != nil {
+		return "", err
+	}
+
+	if result.TwoFactorRequired {
+		return "", ErrTwoFactorRequired
+	}
+
+	return result.Token, nil
+}
+
+// SignIn checks the credentials and returns an access token, or a challenge
+// token to be exchanged with VerifyTwoFactor when the account has 2FA enabled.
+func (s *AuthService) SignIn(ctx context.Context, username, password, ip string) (models.SignInResult, error) {
+	user, err := s.authenticate(ctx, username, password, ip)
+	if err != nil {
+		return models.SignInResult{}, err
+	}
+
+	enabled, err := s.twoFactor.Enabled(ctx, user.ID)
+	if err != nil {
+		return models.SignInResult{}, err
+	}
+
+	if enabled {
+		challenge, err := s.signToken(user.ID, twoFactorChallengePurpose, nil, s.twoFactor.cfg.ChallengeTTL)
+		if err != nil {
+			return models.SignInResult{}, err
+		}
+
+		return models.SignInResult{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+
+	token, err := s.signToken(user.ID, "", roleScopes(user.Role), s.tokens.TTL)
+	if err != nil {
+		return models.SignInResult{}, err
+	}
+
+	return models.SignInResult{Token: token}, nil
 }
 
-func (s *AuthService) GenerateToken(username, password string) (string, error) {
-	user, err := s.repo.GetUser(username, generatePasswordHash(password))
+// VerifyTwoFactor exchanges a sign-in challenge token and a TOTP or recovery
+// code for an access token. Wrong codes count towards the account lockout.
+func (s *AuthService) VerifyTwoFactor(ctx context.Context, challengeToken, code, ip string) (string, error) {
+	challenge, err := s.parseToken(challengeToken, twoFactorChallengePurpose)
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+
+	userID := challenge.UserID
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("2fa:%d", userID)
+	if err = s.checkLock(ctx, key, user.Username, ip); err != nil {
+		return "", err
+	}
+
+	err = s.twoFactor.Verify(ctx, userID, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		attempt, err := s.attempts.RegisterFailure(ctx, key, s.lockout.FailureWindow)
+		if err != nil {
+			return "", err
+		}
+
+		if s.lockout.MaxFailures > 0 && attempt.Failures >= s.lockout.MaxFailures {
+			if err = s.lock(ctx, attempt, models.AuditAccountLocked, user.Username, ip); err != nil {
+				return "", err
+			}
+		}
+
+		return "", ErrInvalidTwoFactorCode
+	}
 	if err != nil {
 		return "", err
 	}
 
+	if err = s.attempts.Reset(ctx, key); err != nil {
+		return "", err
+	}
+
+	return s.signToken(userID, "", roleScopes(user.Role), s.tokens.TTL)
+}
+
+// ParseToken validates an access token. The user is looked up so tokens of
+// deleted or disabled accounts are rejected and scopes lost with a role change
+// are dropped.
+func (s *AuthService) ParseToken(ctx context.Context, accessToken string) (models.Identity, error) {
+	claims, err := s.parseToken(accessToken, "")
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	return s.identity(ctx, claims)
+}
+
+// IssueStreamToken returns a short-lived token that only opens the item
+// streams, for clients that pass it in the URL or a cookie.
+func (s *AuthService) IssueStreamToken(userID int) (models.StreamToken, error) {
+	expiresAt := time.Now().Add(streamTokenTTL)
+	token, err := s.signToken(userID, streamPurpose, []string{models.ScopeItemsRead}, streamTokenTTL)
+	if err != nil {
+		return models.StreamToken{}, err
+	}
+
+	return models.StreamToken{Token: token, ExpiresAt: expiresAt.UTC()}, nil
+}
+
+// ParseStreamToken validates a token from IssueStreamToken like ParseToken
+// does an access token.
+func (s *AuthService) ParseStreamToken(ctx context.Context, streamToken string) (models.Identity, error) {
+	claims, err := s.parseToken(streamToken, streamPurpose)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	return s.identity(ctx, claims)
+}
+
+// identity checks that the user of claims may still sign in and narrows the
+// scopes of claims to those of the user's role.
+func (s *AuthService) identity(ctx context.Context, claims *tokenClaims) (models.Identity, error) {
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Identity{}, errors.New("user no longer exists")
+	}
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	if user.Disabled {
+		return models.Identity{}, ErrAccountDisabled
+	}
+
+	allowed := roleScopes(user.Role)
+	if claims.Scopes == nil {
+		// tokens issued before scopes were added to the claims
+		return models.Identity{UserID: user.ID, Scopes: allowed}, nil
+	}
+
+	scopes := make([]string, 0, len(claims.Scopes))
+	for _, scope := range claims.Scopes {
+		for _, a := range allowed {
+			if scope == a {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+
+	return models.Identity{UserID: user.ID, Scopes: scopes}, nil
+}
+
+func (s *AuthService) authenticate(ctx context.Context, username, password, ip string) (models.User, error) {
+	username = normalizeUsername(username)
+	userKey, ipKey := "user:"+strings.ToLower(username), "ip:"+ip
+	if err := s.checkLock(ctx, userKey, username, ip); err != nil {
+		return models.User{}, err
+	}
+	if err := s.checkLock(ctx, ipKey, username, ip); err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.repo.GetUser(ctx, username, generatePasswordHash(password))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		delay, err := s.registerFailure(ctx, userKey, ipKey, username, ip)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		// slow down guessing; the same error is returned whether or not the username exists
+		time.Sleep(delay)
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err = s.attempts.Reset(ctx, userKey); err != nil {
+		return models.User{}, err
+	}
+
+	// only reported once the password is right, so it doesn't reveal anything to guessers
+	if user.Disabled {
+		return models.User{}, ErrAccountDisabled
+	}
+
+	return user, nil
+}
+
+func (s *AuthService) signToken(userID int, purpose string, scopes []string, ttl time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
-		user.ID,
+		userID,
+		purpose,
+		scopes,
 	})
 
-	return token.SignedString([]byte(signingKey))
+	return token.SignedString(s.tokens.SigningKey)
 }
 
-func (s *AuthService) ParseToken(accessToken string) (int, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+// parseToken validates the token and checks that it was issued for purpose;
+// access tokens have an empty purpose.
+func (s *AuthService) parseToken(rawToken, purpose string) (*tokenClaims, error) {
+	token, err := jwt.ParseWithClaims(rawToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(signingKey), nil
+		return s.tokens.SigningKey, nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	claims, ok := token.Claims.(*tokenClaims)
 	if !ok {
-		return 0, errors.New("token claims are not of type *tokenClaims")
+		return nil, errors.New("token claims are not of type *tokenClaims")
 	}
 
-	return claims.UserID, err
+	if claims.Purpose != purpose {
+		return nil, errors.New("token was not issued for this purpose")
+	}
+
+	return claims, nil
+}
+
+// checkLock fails while key is locked and lifts a lock that has expired.
+func (s *AuthService) checkLock(ctx context.Context, key, username, ip string) error {
+	attempt, err := s.attempts.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if attempt.LockedUntil == nil {
+		return nil
+	}
+
+	if time.Now().Before(*attempt.LockedUntil) {
+		return &LoginLockedError{Until: *attempt.LockedUntil}
+	}
+
+	if err = s.attempts.Unlock(ctx, key); err != nil {
+		return err
+	}
+
+	event := models.AuditAccountUnlocked
+	if strings.HasPrefix(key, "ip:") {
+		event = models.AuditIPUnlocked
+	}
+	s.writeAudit(ctx, models.AuthAuditEntry{Username: username, IP: ip, Event: event, Details: "lockout expired"})
+
+	return nil
+}
+
+// registerFailure counts the failed login for the username and the IP, locks
+// whichever went over its limit and returns how long to delay the response.
+func (s *AuthService) registerFailure(ctx context.Context, userKey, ipKey, username, ip string) (time.Duration, error) {
+	userAttempt, err := s.attempts.RegisterFailure(ctx, userKey, s.lockout.FailureWindow)
+	if err != nil {
+		return 0, err
+	}
+
+	ipAttempt, err := s.attempts.RegisterFailure(ctx, ipKey, s.lockout.FailureWindow)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.lockout.MaxFailures > 0 && userAttempt.Failures >= s.lockout.MaxFailures {
+		if err = s.lock(ctx, userAttempt, models.AuditAccountLocked, username, ip); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.lockout.MaxIPFailures > 0 && ipAttempt.Failures >= s.lockout.MaxIPFailures {
+		if err = s.lock(ctx, ipAttempt, models.AuditIPLocked, username, ip); err != nil {
+			return 0, err
+		}
+	}
+
+	return progressiveDuration(s.lockout.BaseDelay, s.lockout.MaxDelay, userAttempt.Failures-1), nil
+}
+
+func (s *AuthService) lock(ctx context.Context, attempt models.LoginAttempt, event, username, ip string) error {
+	duration := progressiveDuration(s.lockout.LockoutDuration, s.lockout.MaxLockoutDuration, attempt.Lockouts)
+	until, err := s.attempts.Lock(ctx, attempt.Key, duration)
+	if err != nil {
+		return err
+	}
+
+	s.writeAudit(ctx, models.AuthAuditEntry{
+		Username: username,
+		IP:       ip,
+		Event:    event,
+		Details:  fmt.Sprintf("%d failed logins, locked until %s", attempt.Failures, until.UTC().Format(time.RFC3339)),
+	})
+
+	return nil
+}
+
+func (s *AuthService) writeAudit(ctx context.Context, entry models.AuthAuditEntry) {
+	if err := s.audit.Log(ctx, entry); err != nil {
+		logrus.Errorf("couldn't write auth audit log: %s", err.Error())
+	}
+}
+
+// progressiveDuration doubles base n times, capped at limit.
+func progressiveDuration(base, limit time.Duration, n int) time.Duration {
+	d := base
+	for i := 0; i < n && d < limit; i++ {
+		d *= 2
+	}
+
+	if limit > 0 && d > limit {
+		return limit
+	}
+
+	return d
+}
+
+// roleScopes returns the scopes granted to role; unknown roles get the user's.
+func roleScopes(role string) []string {
+	if scopes, ok := models.RoleScopes[role]; ok {
+		return scopes
+	}
 
+	return models.RoleScopes[models.RoleUser]
 }
 
 func generatePasswordHash(password string) string {
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAuthService_UsernameWhitespace(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepository()
+	s := NewAuthService(repos.Authorization, repos.LoginAttempt, repos.AuthAudit,
+		NewTwoFactorService(repos.TwoFactor, repos.Authorization, TwoFactorConfig{}),
+		TokenConfig{SigningKey: []byte("test"), TTL: time.Hour},
+		LockoutConfig{MaxFailures: 5, MaxIPFailures: 5, FailureWindow: time.Minute})
+
+	_, err := s.CreateUser(ctx, models.User{Name: "Alice", Username: " alice ", Password: "secret"})
+	require.NoError(t, err)
+
+	available, err := s.UsernameAvailable(ctx, "alice ")
+	require.NoError(t, err)
+	require.False(t, available)
+
+	_, err = s.CreateUser(ctx, models.User{Name: "Alice", Username: "alice", Password: "other"})
+	require.ErrorIs(t, err, ErrUsernameTaken)
+
+	_, err = s.GenerateToken(ctx, "alice", "secret", "127.0.0.1")
+	require.NoError(t, err)
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/storage"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// exportStaleAfter is when a pending export is assumed lost, e.g. to a
+	// restart, and a new one may be started.
+	exportStaleAfter = time.Hour
+)
+
+var (
+	ErrExportInProgress  = errors.New("an export is already being prepared")
+	ErrExportNotReady    = errors.New("export is not ready")
+	ErrInvalidExportLink = errors.New("invalid or expired download link")
+)
+
+type ExportConfig struct {
+	// TTL is how long a finished archive is kept and its link works.
+	TTL time.Duration
+	// SigningKey signs download links.
+	SigningKey []byte
+}
+
+type ExportService struct {
+	repo     repository.Export
+	profiles repository.Profile
+	webhooks repository.Webhook
+	tokens   repository.AccessToken
+	store    storage.Store
+	runner   *jobs.Runner
+	cfg      ExportConfig
+}
+
+func NewExportService(repos *repository.Repository, store storage.Store, runner *jobs.Runner,
+	cfg ExportConfig) *ExportService {
+	return &ExportService{
+		repo:     repos.Export,
+		profiles: repos.Profile,
+		webhooks: repos.Webhook,
+		tokens:   repos.AccessToken,
+		store:    store,
+		runner:   runner,
+		cfg:      cfg,
+	}
+}
+
+// Request starts building an export in the background.
+func (s *ExportService) Request(ctx context.Context, userID int) (models.DataExport, error) {
+	_, err := s.repo.GetPending(ctx, userID, exportStaleAfter)
+	if err == nil {
+		return models.DataExport{}, ErrExportInProgress
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DataExport{}, err
+	}
+
+	export, err := s.repo.Create(ctx, userID)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+
+	err = s.runner.Enqueue(fmt.Sprintf("export %d", export.ID), func() error {
+		return s.build(tracing.Detach(ctx), export)
+	})
+	if err != nil {
+		if markErr := s.repo.MarkFailed(ctx, export.ID, err.Error()); markErr != nil {
+			logrus.Errorf("couldn't mark export %d failed: %s", export.ID, markErr.Error())
+		}
+		return models.DataExport{}, err
+	}
+
+	return export, nil
+}
+
+func (s *ExportService) GetAll(ctx context.Context, userID int) ([]models.DataExport, error) {
+	exports, err := s.repo.GetAll(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range exports {
+		s.setDownloadURL(&exports[i])
+	}
+
+	return exports, nil
+}
+
+func (s *ExportService) GetByID(ctx context.Context, userID, exportID int) (models.DataExport, error) {
+	export, err := s.repo.GetByID(ctx, exportID)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+
+	if export.UserID != userID {
+		return models.DataExport{}, gorm.ErrRecordNotFound
+	}
+
+	s.setDownloadURL(&export)
+	return export, nil
+}
+
+// Open checks a signed download link and returns the archive.
+func (s *ExportService) Open(ctx context.Context, exportID int, expires int64, signature string) (io.ReadCloser, error) {
+	if time.Now().Unix() > expires || !hmac.Equal([]byte(signature), []byte(s.sign(exportID, expires))) {
+		return nil, ErrInvalidExportLink
+	}
+
+	export, err := s.repo.GetByID(ctx, exportID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidExportLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if export.Status != models.ExportReady {
+		return nil, ErrExportNotReady
+	}
+
+	f, err := s.store.Open(export.FileKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidExportLink
+	}
+
+	return f, err
+}
+
+func (s *ExportService) setDownloadURL(export *models.DataExport) {
+	if export.Status != models.ExportReady || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return
+	}
+
+	expires := export.ExpiresAt.Unix()
+	export.DownloadURL = fmt.Sprintf("/exports/%d/download?expires=%d&signature=%s",
+		export.ID, expires, s.sign(export.ID, expires))
+}
+
+func (s *ExportService) sign(exportID int, expires int64) string {
+	mac := hmac.New(sha256.New, s.cfg.SigningKey)
+	mac.Write([]byte(strconv.Itoa(exportID) + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *ExportService) build(ctx context.Context, export models.DataExport) (err error) {
+	ctx, span := tracing.Start(ctx, "Export.build")
+	defer func() { tracing.End(span, err) }()
+
+	key := fmt.Sprintf("%s/%d.zip", exportDir(export.UserID), export.ID)
+
+	err = s.writeArchive(ctx, export.UserID, key)
+	if err != nil {
+		if markErr := s.repo.MarkFailed(ctx, export.ID, "couldn't build the export"); markErr != nil {
+			logrus.Errorf("couldn't mark export %d failed: %s", export.ID, markErr.Error())
+		}
+		return err
+	}
+
+	return s.repo.MarkReady(ctx, export.ID, key, s.cfg.TTL)
+}
+
+// writeArchive stores a zip with the profile, all items and the account
+// history, as JSON and, for the tabular parts, CSV.
+func (s *ExportService) writeArchive(ctx context.Context, userID int, key string) error {
+	profile, err := s.profiles.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	items, err := s.repo.GetItems(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	history, err := s.repo.GetAuthHistory(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := s.webhooks.GetAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	tokens, err := s.tokens.GetAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	itemRows := [][]string{{"id", "client_id", "title", "description", "done", "removed", "version",
+		"created_at", "updated_at"}}
+	for _, item := range items {
+		itemRows = append(itemRows, []string{strconv.Itoa(item.ID), item.ClientID, item.Title, item.Description,
+			strconv.FormatBool(item.Done), strconv.FormatBool(item.IsRemoved), strconv.Itoa(item.Version),
+			item.CreatedAt.Format(time.RFC3339), item.UpdatedAt.Format(time.RFC3339)})
+	}
+
+	historyRows := [][]string{{"id", "event", "ip", "details", "created_at"}}
+	for _, entry := range history {
+		historyRows = append(historyRows, []string{strconv.Itoa(entry.ID), entry.Event, entry.IP, entry.Details,
+			entry.CreatedAt.Format(time.RFC3339)})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name string
+		v    interface{}
+		csv  [][]string
+	}{
+		{name: "profile.json", v: profile},
+		{name: "items.json", v: items},
+		{name: "items.csv", csv: itemRows},
+		{name: "history.json", v: history},
+		{name: "history.csv", csv: historyRows},
+		{name: "webhooks.json", v: webhooks},
+		{name: "access_tokens.json", v: tokens},
+	}
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		if file.csv != nil {
+			err = csv.NewWriter(w).WriteAll(file.csv)
+		} else {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(file.v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	return s.store.Put(key, &buf)
+}
+
+// Cleanup removes expired archives. The server runs it periodically.
+func (s *ExportService) Cleanup(ctx context.Context) error {
+	exports, err := s.repo.GetExpired(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get expired exports: %w", err)
+	}
+
+	for _, export := range exports {
+		if err = s.store.Delete(export.FileKey); err != nil {
+			logrus.Errorf("couldn't delete export %d archive: %s", export.ID, err.Error())
+			continue
+		}
+
+		if err = s.repo.Delete(ctx, export.ID); err != nil {
+			logrus.Errorf("couldn't delete export %d: %s", export.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// exportDir is the store prefix holding all of the user's archives.
+func exportDir(userID int) string {
+	return fmt.Sprintf("exports/%d", userID)
+}
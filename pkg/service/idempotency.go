@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	maxIdempotencyKeyLength    = 255
+	idempotencyCleanupInterval = time.Hour
+)
+
+var (
+	ErrInvalidIdempotencyKey    = errors.New("idempotency key must be 1 to 255 characters long")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+type IdempotencyConfig struct {
+	TTL time.Duration
+	// Lease is how long a request holds its key before a retry of it may take
+	// the key over, e.g. after the instance running it died.
+	Lease time.Duration
+}
+
+type IdempotencyService struct {
+	repo repository.Idempotency
+	cfg  IdempotencyConfig
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewIdempotencyService(repo repository.Idempotency, cfg IdempotencyConfig) *IdempotencyService {
+	return &IdempotencyService{repo: repo, cfg: cfg}
+}
+
+// Begin claims the key for the request. It returns the stored record when the
+// request was already completed and its response should be replayed, or the
+// reservation to pass to Complete or Release when the request should be
+// processed.
+func (s *IdempotencyService) Begin(ctx context.Context, userID int, key, requestHash string) (models.IdempotencyRecord, error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return models.IdempotencyRecord{}, ErrInvalidIdempotencyKey
+	}
+
+	s.cleanup()
+
+	lockToken, err := generateLockToken()
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	existing, reserved, err := s.repo.Reserve(ctx, models.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		LockToken:   lockToken,
+	}, s.cfg.TTL, s.cfg.Lease)
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	if reserved {
+		return existing, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return models.IdempotencyRecord{}, ErrIdempotencyKeyReused
+	}
+
+	if !existing.Completed {
+		return models.IdempotencyRecord{}, ErrIdempotencyKeyInProgress
+	}
+
+	return existing, nil
+}
+
+// Complete stores the response of the request holding the reservation.
+func (s *IdempotencyService) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	return s.repo.Complete(ctx, record)
+}
+
+// Release frees the key so the request can be retried, e.g. after a server
+// error. A reservation taken over by a retry meanwhile is left alone.
+func (s *IdempotencyService) Release(ctx context.Context, record models.IdempotencyRecord) error {
+	return s.repo.Delete(ctx, record)
+}
+
+func generateLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// cleanup removes expired records at most once per idempotencyCleanupInterval.
+func (s *IdempotencyService) cleanup() {
+	s.mu.Lock()
+	if time.Since(s.lastCleanup) < idempotencyCleanupInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		if err := s.repo.DeleteExpired(context.Background()); err != nil {
+			logrus.Errorf("couldn't delete expired idempotency keys: %s", err.Error())
+		}
+	}()
+}
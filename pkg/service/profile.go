@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	maxNameLength      = 255
+	maxPreferencesSize = 16 << 10
+)
+
+var (
+	ErrInvalidName        = errors.New("name must be 1 to 255 characters long")
+	ErrInvalidTimezone    = errors.New("unknown timezone")
+	ErrInvalidLocale      = errors.New("locale must be a language tag like en or pt-BR")
+	ErrInvalidPreferences = fmt.Errorf("preferences must be a JSON object of at most %d bytes", maxPreferencesSize)
+	ErrWrongPassword      = errors.New("password is incorrect")
+)
+
+var localeRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+type ProfileConfig struct {
+	// DeletionGracePeriod is how long a deleted account can still be restored.
+	DeletionGracePeriod time.Duration
+}
+
+type ProfileService struct {
+	repo   repository.Profile
+	users  repository.Authorization
+	tokens repository.UserToken
+	audit  repository.AuthAudit
+	store  storage.Store
+	cfg    ProfileConfig
+}
+
+func NewProfileService(repo repository.Profile, users repository.Authorization, tokens repository.UserToken,
+	audit repository.AuthAudit, store storage.Store, cfg ProfileConfig) *ProfileService {
+	return &ProfileService{repo: repo, users: users, tokens: tokens, audit: audit, store: store, cfg: cfg}
+}
+
+func (s *ProfileService) Get(ctx context.Context, userID int) (models.Profile, error) {
+	return s.repo.Get(ctx, userID)
+}
+
+func (s *ProfileService) Update(ctx context.Context, userID int, input models.ProfileUpdateInput) (models.Profile, error) {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || len(name) > maxNameLength {
+			return models.Profile{}, ErrInvalidName
+		}
+		input.Name = &name
+	}
+
+	if input.Timezone != nil {
+		// LoadLocation also accepts "" and "Local", which mean the server's zone
+		if *input.Timezone == "" || *input.Timezone == "Local" {
+			return models.Profile{}, ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(*input.Timezone); err != nil {
+			return models.Profile{}, ErrInvalidTimezone
+		}
+	}
+
+	if input.Locale != nil && !localeRe.MatchString(*input.Locale) {
+		return models.Profile{}, ErrInvalidLocale
+	}
+
+	if input.Preferences != nil {
+		p := bytes.TrimSpace(*input.Preferences)
+		if len(p) > maxPreferencesSize || len(p) == 0 || p[0] != '{' || !json.Valid(p) {
+			return models.Profile{}, ErrInvalidPreferences
+		}
+	}
+
+	if err := s.repo.Update(ctx, userID, input); err != nil {
+		return models.Profile{}, err
+	}
+
+	return s.repo.Get(ctx, userID)
+}
+
+func (s *ProfileService) ChangePassword(ctx context.Context, userID int, currentPassword, newPassword string) error {
+	user, err := s.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	if err = s.users.UpdatePassword(ctx, userID, generatePasswordHash(newPassword)); err != nil {
+		return err
+	}
+
+	// reset links sent before the change shouldn't be able to undo it
+	if err = s.tokens.DeleteByUser(ctx, userID, models.TokenPasswordReset); err != nil {
+		return err
+	}
+
+	s.writeAudit(ctx, user, models.AuditPasswordChanged, "")
+
+	return nil
+}
+
+// ScheduleDeletion deletes the account, with all its data, once the grace
+// period is over. Until then it works as before and can be restored.
+func (s *ProfileService) ScheduleDeletion(ctx context.Context, userID int, password string) (time.Time, error) {
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	deleteAfter, err := s.repo.ScheduleDeletion(ctx, userID, s.cfg.DeletionGracePeriod)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.writeAudit(ctx, user, models.AuditAccountDeletionScheduled, "delete after "+deleteAfter.UTC().Format(time.RFC3339))
+
+	return deleteAfter, nil
+}
+
+func (s *ProfileService) CancelDeletion(ctx context.Context, userID int) error {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repo.CancelDeletion(ctx, userID); err != nil {
+		return err
+	}
+
+	s.writeAudit(ctx, user, models.AuditAccountDeletionCancelled, "")
+
+	return nil
+}
+
+func (s *ProfileService) checkPassword(ctx context.Context, userID int, password string) (models.User, error) {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = s.users.GetUser(ctx, user.Username, generatePasswordHash(password))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, ErrWrongPassword
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// Purge deletes accounts whose grace period is over, together with their
+// export archives. The server runs it periodically.
+func (s *ProfileService) Purge(ctx context.Context) error {
+	ids, err := s.repo.DeleteScheduled(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't delete accounts scheduled for deletion: %w", err)
+	}
+
+	for _, id := range ids {
+		if err = s.store.DeleteAll(exportDir(id)); err != nil {
+			logrus.Errorf("couldn't delete export archives of deleted user %d: %s", id, err.Error())
+		}
+	}
+
+	if len(ids) > 0 {
+		s.writeAudit(ctx, models.User{}, models.AuditAccountsPurged, fmt.Sprintf("%d accounts deleted", len(ids)))
+	}
+
+	return nil
+}
+
+func (s *ProfileService) writeAudit(ctx context.Context, user models.User, event, details string) {
+	entry := models.AuthAuditEntry{Username: user.Username, Event: event, Details: details}
+	if user.ID != 0 {
+		entry.UserID = &user.ID
+	}
+
+	if err := s.audit.Log(ctx, entry); err != nil {
+		logrus.Errorf("couldn't write auth audit log: %s", err.Error())
+	}
+}
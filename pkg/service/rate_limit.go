@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitByUser = "user"
+	RateLimitByIP   = "ip"
+
+	rateLimitCleanupInterval = 10 * time.Minute
+	// rateLimitMinIdle is the least a bucket stays after its last request.
+	rateLimitMinIdle = time.Hour
+)
+
+// RateLimitRule is a token bucket refilled with Requests tokens per Period
+// and holding at most Burst tokens.
+type RateLimitRule struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+	// KeyBy is either RateLimitByUser or RateLimitByIP.
+	KeyBy string
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	Rules   map[string]RateLimitRule
+}
+
+type RateLimitService struct {
+	repo repository.RateLimit
+	cfg  RateLimitConfig
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewRateLimitService(repo repository.RateLimit, cfg RateLimitConfig) *RateLimitService {
+	return &RateLimitService{repo: repo, cfg: cfg}
+}
+
+// Rule returns the rule of the route group, if the group is rate limited.
+func (s *RateLimitService) Rule(group string) (RateLimitRule, bool) {
+	if !s.cfg.Enabled {
+		return RateLimitRule{}, false
+	}
+
+	rule, ok := s.cfg.Rules[group]
+	if !ok || rule.Requests <= 0 || rule.Period <= 0 {
+		return RateLimitRule{}, false
+	}
+
+	return rule, true
+}
+
+// Allow takes a token from the bucket of key in the route group. If the store
+// fails, the request is allowed so that limiting never takes the API down.
+func (s *RateLimitService) Allow(ctx context.Context, group, key string) (models.RateLimitResult, error) {
+	rule, ok := s.Rule(group)
+	if !ok {
+		return models.RateLimitResult{Allowed: true}, nil
+	}
+
+	s.cleanup()
+
+	capacity, rate := rule.capacity(), rule.rate()
+
+	tokens, allowed, err := s.repo.Take(ctx, group+":"+key, capacity, rate)
+	if err != nil {
+		return models.RateLimitResult{Allowed: true}, err
+	}
+
+	result := models.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     rule.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((capacity - tokens) / rate),
+	}
+
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+
+	return result, nil
+}
+
+func (r RateLimitRule) capacity() float64 {
+	if r.Burst <= 0 {
+		return float64(r.Requests)
+	}
+	return float64(r.Burst)
+}
+
+func (r RateLimitRule) rate() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+// idleTTL is how long buckets must go unused before they can be deleted
+// without lifting a limit: long enough for the bucket of every rule to have
+// refilled completely, and at least the longest period.
+func (s *RateLimitService) idleTTL() time.Duration {
+	ttl := rateLimitMinIdle
+	for group := range s.cfg.Rules {
+		rule, ok := s.Rule(group)
+		if !ok {
+			continue
+		}
+
+		refill := time.Duration(rule.capacity() / rule.rate() * float64(time.Second))
+		for _, d := range []time.Duration{rule.Period, refill} {
+			if d > ttl {
+				ttl = d
+			}
+		}
+	}
+
+	return ttl
+}
+
+// cleanup removes idle buckets at most once per rateLimitCleanupInterval.
+func (s *RateLimitService) cleanup() {
+	s.mu.Lock()
+	if time.Since(s.lastCleanup) < rateLimitCleanupInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		if err := s.repo.DeleteIdle(context.Background(), s.idleTTL()); err != nil {
+			logrus.Errorf("couldn't delete idle rate limit buckets: %s", err.Error())
+		}
+	}()
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds)) * time.Second
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimitService_Allow(t *testing.T) {
+	s := NewRateLimitService(repository.NewRateLimitMemory(), RateLimitConfig{
+		Enabled: true,
+		Rules: map[string]RateLimitRule{
+			"api": {Requests: 2, Period: time.Minute, Burst: 5, KeyBy: RateLimitByIP},
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		result, err := s.Allow(context.Background(), "api", "ip:1")
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		// the quota per period is reported, not the burst
+		require.Equal(t, 2, result.Limit)
+		require.Equal(t, 4-i, result.Remaining)
+	}
+
+	result, err := s.Allow(context.Background(), "api", "ip:1")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+}
+
+func TestRateLimitService_IdleTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]RateLimitRule
+		want  time.Duration
+	}{
+		{name: "short periods", rules: map[string]RateLimitRule{
+			"api": {Requests: 100, Period: time.Minute},
+		}, want: rateLimitMinIdle},
+		{name: "period above the minimum", rules: map[string]RateLimitRule{
+			"api":    {Requests: 100, Period: time.Minute},
+			"export": {Requests: 3, Period: 24 * time.Hour},
+		}, want: 24 * time.Hour},
+		{name: "burst refilling slower than the period", rules: map[string]RateLimitRule{
+			"bulk": {Requests: 1, Period: time.Hour, Burst: 10},
+		}, want: 10 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewRateLimitService(repository.NewRateLimitMemory(), RateLimitConfig{Enabled: true, Rules: tt.rules})
+			require.Equal(t, tt.want, s.idleTTL())
+		})
+	}
+}
@@ -1,36 +1,168 @@
 package service
 
 import (
+	"context"
 	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/mailer"
 	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/storage"
+	"io"
+	"time"
 )
 
 //go:generate mockgen -source=service.go -destination=mocks/mock.go
 
 type Authorization interface {
-	CreateUser(user models.User) (int, error)
-	GenerateToken(username, password string) (string, error)
-	ParseToken(token string) (int, error)
+	CreateUser(ctx context.Context, user models.User) (int, error)
+	UsernameAvailable(ctx context.Context, username string) (bool, error)
+	GenerateToken(ctx context.Context, username, password, ip string) (string, error)
+	SignIn(ctx context.Context, username, password, ip string) (models.SignInResult, error)
+	VerifyTwoFactor(ctx context.Context, challengeToken, code, ip string) (string, error)
+	ParseToken(ctx context.Context, token string) (models.Identity, error)
+	IssueStreamToken(userID int) (models.StreamToken, error)
+	ParseStreamToken(ctx context.Context, token string) (models.Identity, error)
+}
+
+type Account interface {
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	SendVerificationEmail(ctx context.Context, userID int) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type TwoFactor interface {
+	Enroll(ctx context.Context, userID int) (models.TwoFactorEnrollment, error)
+	Confirm(ctx context.Context, userID int, code string) ([]string, error)
+	Disable(ctx context.Context, userID int, code string) error
+}
+
+type AccessToken interface {
+	Create(ctx context.Context, userID int, input models.PersonalAccessTokenInput) (models.PersonalAccessToken, error)
+	GetAll(ctx context.Context, userID int) ([]models.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, tokenID int) error
+	Authenticate(ctx context.Context, token string) (models.PersonalAccessToken, error)
+}
+
+type Admin interface {
+	ListUsers(ctx context.Context, actorID int, ip, search string, limit, offset int) (models.AdminUserList, error)
+	GetUser(ctx context.Context, actorID int, ip string, userID int) (models.AdminUser, error)
+	SetDisabled(ctx context.Context, actorID int, ip string, userID int, disabled bool) error
+	DeleteUser(ctx context.Context, actorID int, ip string, userID int) error
+	ForcePasswordReset(ctx context.Context, actorID int, ip string, userID int) error
+}
+
+type Profile interface {
+	Get(ctx context.Context, userID int) (models.Profile, error)
+	Update(ctx context.Context, userID int, input models.ProfileUpdateInput) (models.Profile, error)
+	ChangePassword(ctx context.Context, userID int, currentPassword, newPassword string) error
+	ScheduleDeletion(ctx context.Context, userID int, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID int) error
+	Purge(ctx context.Context) error
+}
+
+type Export interface {
+	Request(ctx context.Context, userID int) (models.DataExport, error)
+	GetAll(ctx context.Context, userID int) ([]models.DataExport, error)
+	GetByID(ctx context.Context, userID, exportID int) (models.DataExport, error)
+	Open(ctx context.Context, exportID int, expires int64, signature string) (io.ReadCloser, error)
+	Cleanup(ctx context.Context) error
 }
 
 type TodoItem interface {
-	Create(item models.TodoItem) (int, error)
-	BulkCreate(userID int, items []models.TodoItem) error
-	GetAll(userID int) ([]models.TodoItem, error)
-	GetByID(userID, ItemID int) (models.TodoItem, error)
-	Delete(userID, itemID int) error
-	Update(userID, itemID int, input models.TodoItem) error
-	ChangeStatus(userID, itemID int, status bool) error
+	Create(ctx context.Context, item models.TodoItem) (int, error)
+	BulkCreate(ctx context.Context, userID int, items []models.TodoItem) ([]int, error)
+	GetAll(ctx context.Context, userID int) ([]models.TodoItem, error)
+	GetByID(ctx context.Context, userID, ItemID int) (models.TodoItem, error)
+	Delete(ctx context.Context, userID, itemID int) error
+	Update(ctx context.Context, userID, itemID int, input models.TodoItem) error
+	ChangeStatus(ctx context.Context, userID, itemID int, status bool) error
+}
+
+type Webhook interface {
+	Create(ctx context.Context, userID int, input models.WebhookInput) (models.Webhook, error)
+	GetAll(ctx context.Context, userID int) ([]models.Webhook, error)
+	GetByID(ctx context.Context, userID, webhookID int) (models.Webhook, error)
+	Delete(ctx context.Context, userID, webhookID int) error
+	GetDeliveries(ctx context.Context, userID, webhookID int) ([]models.WebhookDelivery, error)
+	GetDeliveryByID(ctx context.Context, userID, webhookID, deliveryID int) (models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, userID, webhookID, deliveryID int) (int, error)
+	Dispatch(ctx context.Context, userID int, event string, data interface{})
+	RetryDue(ctx context.Context) error
+}
+
+type Stream interface {
+	Publish(userID int, eventType string, data interface{})
+	Subscribe(userID int, lastEventID int64) ([]models.ItemEvent, <-chan models.ItemEvent, func())
+	Close(ctx context.Context) error
+}
+
+type Sync interface {
+	GetChanges(ctx context.Context, userID int, token string) (models.SyncChanges, error)
+	Apply(ctx context.Context, userID int, batch models.SyncBatch) ([]models.SyncResult, error)
+}
+
+type Idempotency interface {
+	Begin(ctx context.Context, userID int, key, requestHash string) (models.IdempotencyRecord, error)
+	Complete(ctx context.Context, record models.IdempotencyRecord) error
+	Release(ctx context.Context, record models.IdempotencyRecord) error
+}
+
+type RateLimit interface {
+	Rule(group string) (RateLimitRule, bool)
+	Allow(ctx context.Context, group, key string) (models.RateLimitResult, error)
+}
+
+type Config struct {
+	Token       TokenConfig
+	Lockout     LockoutConfig
+	Account     AccountConfig
+	TwoFactor   TwoFactorConfig
+	Profile     ProfileConfig
+	Export      ExportConfig
+	Webhook     WebhookConfig
+	Stream      StreamConfig
+	Idempotency IdempotencyConfig
+	RateLimit   RateLimitConfig
 }
 
 type Service struct {
 	Authorization
+	Account
+	TwoFactor
+	AccessToken
+	Admin
+	Profile
+	Export
 	TodoItem
+	Webhook
+	Stream
+	Sync
+	Idempotency
+	RateLimit
 }
 
-func NewService(repos *repository.Repository) *Service {
+func NewService(repos *repository.Repository, mailer mailer.Mailer, store storage.Store, runner *jobs.Runner,
+	cfg Config) *Service {
+	twoFactor := NewTwoFactorService(repos.TwoFactor, repos.Authorization, cfg.TwoFactor)
+	account := NewAccountService(repos.Authorization, repos.UserToken, mailer, cfg.Account)
+
+	auth := NewAuthService(repos.Authorization, repos.LoginAttempt, repos.AuthAudit, twoFactor, cfg.Token, cfg.Lockout)
+	profile := NewProfileService(repos.Profile, repos.Authorization, repos.UserToken, repos.AuthAudit, store, cfg.Profile)
+
 	return &Service{
-		Authorization: NewAuthService(repos.Authorization),
-		TodoItem:      NewTodoItemService(repos.TodoItem),
+		Authorization: tracedAuthorization{next: auth},
+		Account:       tracedAccount{next: account},
+		TwoFactor:     tracedTwoFactor{next: twoFactor},
+		AccessToken:   tracedAccessToken{next: NewAccessTokenService(repos.AccessToken)},
+		Admin:         tracedAdmin{next: NewAdminService(repos.Admin, repos.AuthAudit, repos.Transactor, account)},
+		Profile:       tracedProfile{next: profile},
+		Export:        tracedExport{next: NewExportService(repos, store, runner, cfg.Export)},
+		TodoItem:      tracedTodoItem{next: NewTodoItemService(repos.TodoItem, repos.Transactor)},
+		Webhook:       tracedWebhook{next: NewWebhookService(repos.Webhook, runner, cfg.Webhook)},
+		Stream:        NewStreamService(cfg.Stream),
+		Sync:          tracedSync{next: NewSyncService(repos.TodoItem)},
+		Idempotency:   tracedIdempotency{next: NewIdempotencyService(repos.Idempotency, cfg.Idempotency)},
+		RateLimit:     tracedRateLimit{next: NewRateLimitService(repos.RateLimit, cfg.RateLimit)},
 	}
 }
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"sync"
+	"time"
+)
+
+type StreamConfig struct {
+	// HistorySize is how many recent events are kept per user for resuming streams.
+	HistorySize int
+	// BufferSize is how many events a subscriber may lag behind before it is disconnected.
+	BufferSize int
+}
+
+// StreamService is an in-process event bus that fans item events out to the
+// live streams of their owner. Streams only get the events of writes handled
+// by the same instance, and event IDs only mean something to the process
+// that handed them out, so the streams need a single instance. Clients resuming with an unknown
+// Last-Event-ID get an EventStreamResync event and fall back to /api/sync.
+type StreamService struct {
+	cfg StreamConfig
+
+	mu          sync.Mutex
+	lastID      int64
+	history     map[int][]models.ItemEvent
+	subscribers map[int]map[chan models.ItemEvent]struct{}
+	// closed refuses new subscribers once Close has ended the streams.
+	closed bool
+	// active counts subscribers that haven't unsubscribed yet.
+	active sync.WaitGroup
+
+	// firstID is where this process started numbering events: its start
+	// time in microseconds, so it is above any ID a previous run handed out.
+	firstID int64
+}
+
+func NewStreamService(cfg StreamConfig) *StreamService {
+	start := time.Now().UnixMicro()
+	return &StreamService{
+		cfg:         cfg,
+		lastID:      start,
+		history:     make(map[int][]models.ItemEvent),
+		subscribers: make(map[int]map[chan models.ItemEvent]struct{}),
+		firstID:     start,
+	}
+}
+
+func (s *StreamService) Publish(userID int, eventType string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	event := models.ItemEvent{
+		ID:        s.lastID,
+		Type:      eventType,
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	history := append(s.history[userID], event)
+	if len(history) > s.cfg.HistorySize {
+		history = history[len(history)-s.cfg.HistorySize:]
+	}
+	s.history[userID] = history
+
+	for ch := range s.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			// the subscriber can't keep up; closing its channel ends the stream
+			// and the client resumes from its last event ID
+			delete(s.subscribers[userID], ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the user's events. Events newer than
+// lastEventID that are still in history are returned to be replayed first.
+// If some may be gone, an EventStreamResync event is returned instead.
+// The returned function must be called to unsubscribe.
+func (s *StreamService) Subscribe(userID int, lastEventID int64) ([]models.ItemEvent, <-chan models.ItemEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		ch := make(chan models.ItemEvent)
+		close(ch)
+		return nil, ch, func() {}
+	}
+
+	var missed []models.ItemEvent
+	if lastEventID > 0 {
+		if s.resumable(userID, lastEventID) {
+			for _, event := range s.history[userID] {
+				if event.ID > lastEventID {
+					missed = append(missed, event)
+				}
+			}
+		} else {
+			missed = []models.ItemEvent{{
+				ID:        s.lastID,
+				Type:      models.EventStreamResync,
+				CreatedAt: time.Now().UTC(),
+			}}
+		}
+	}
+
+	ch := make(chan models.ItemEvent, s.cfg.BufferSize)
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan models.ItemEvent]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	s.active.Add(1)
+
+	var once sync.Once
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.subscribers[userID][ch]; ok {
+			delete(s.subscribers[userID], ch)
+			close(ch)
+		}
+
+		if len(s.subscribers[userID]) == 0 {
+			delete(s.subscribers, userID)
+		}
+		once.Do(s.active.Done)
+	}
+
+	return missed, ch, cancel
+}
+
+// Close ends every stream and refuses new ones, then waits until all
+// subscribers have unsubscribed or ctx is done. The server's Shutdown would
+// otherwise wait out its timeout on the streams, and doesn't wait for the
+// hijacked WebSocket connections at all.
+func (s *StreamService) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for userID, subscribers := range s.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(s.subscribers, userID)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resumable reports whether history still has every event of the user after
+// lastEventID. An ID this process hasn't handed out comes from before a
+// restart or from another instance.
+func (s *StreamService) resumable(userID int, lastEventID int64) bool {
+	if lastEventID < s.firstID || lastEventID > s.lastID {
+		return false
+	}
+
+	history := s.history[userID]
+	return len(history) < s.cfg.HistorySize || history[0].ID <= lastEventID+1
+}
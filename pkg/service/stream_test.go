@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStreamService_Subscribe(t *testing.T) {
+	s := NewStreamService(StreamConfig{HistorySize: 2, BufferSize: 8})
+	s.Publish(1, models.EventItemCreated, nil)
+	first := s.lastID
+	s.Publish(1, models.EventItemUpdated, nil)
+	s.Publish(2, models.EventItemCreated, nil)
+
+	tests := []struct {
+		name        string
+		lastEventID int64
+		want        []string
+	}{
+		{name: "new stream", lastEventID: 0, want: nil},
+		{name: "resumes from history", lastEventID: first, want: []string{models.EventItemUpdated}},
+		{name: "up to date", lastEventID: s.lastID, want: nil},
+		{name: "from before a restart", lastEventID: s.firstID - 1, want: []string{models.EventStreamResync}},
+		{name: "unknown id", lastEventID: s.lastID + 1, want: []string{models.EventStreamResync}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, _, cancel := s.Subscribe(1, tt.lastEventID)
+			defer cancel()
+
+			var got []string
+			for _, event := range missed {
+				got = append(got, event.Type)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("evicted from history", func(t *testing.T) {
+		s.Publish(1, models.EventItemDeleted, nil)
+
+		missed, _, cancel := s.Subscribe(1, first-1)
+		defer cancel()
+
+		require.Len(t, missed, 1)
+		require.Equal(t, models.EventStreamResync, missed[0].Type)
+		require.Equal(t, s.lastID, missed[0].ID)
+	})
+}
+
+func TestStreamService_Close(t *testing.T) {
+	s := NewStreamService(StreamConfig{HistorySize: 2, BufferSize: 8})
+	_, events, cancel := s.Subscribe(1, 0)
+
+	// a subscriber that doesn't unsubscribe holds Close until ctx is done
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelCtx()
+	require.ErrorIs(t, s.Close(ctx), context.DeadlineExceeded)
+
+	_, ok := <-events
+	require.False(t, ok)
+
+	cancel()
+	require.NoError(t, s.Close(context.Background()))
+
+	// streams opened afterwards end right away
+	_, events, cancel = s.Subscribe(1, 0)
+	defer cancel()
+	_, ok = <-events
+	require.False(t, ok)
+}
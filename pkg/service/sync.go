@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/metrics"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+const syncPageSize = 500
+
+var (
+	ErrInvalidSyncToken    = errors.New("invalid sync token")
+	ErrInvalidSyncStrategy = errors.New("unknown conflict resolution strategy")
+)
+
+type SyncService struct {
+	repo repository.TodoItem
+}
+
+func NewSyncService(repo repository.TodoItem) *SyncService {
+	return &SyncService{repo: repo}
+}
+
+// GetChanges returns the items created, modified or removed after token.
+// An empty token means a full sync.
+func (s *SyncService) GetChanges(ctx context.Context, userID int, token string) (models.SyncChanges, error) {
+	var since int64
+	if token != "" {
+		var err error
+		since, err = strconv.ParseInt(token, 10, 64)
+		if err != nil || since < 0 {
+			return models.SyncChanges{}, ErrInvalidSyncToken
+		}
+	}
+
+	items, err := s.repo.GetChanges(ctx, userID, since, syncPageSize+1)
+	if err != nil {
+		return models.SyncChanges{}, err
+	}
+
+	changes := models.SyncChanges{
+		Items:      []models.SyncItem{},
+		Tombstones: []models.Tombstone{},
+		NextToken:  strconv.FormatInt(since, 10),
+	}
+
+	if len(items) > syncPageSize {
+		items = items[:syncPageSize]
+		changes.HasMore = true
+	}
+
+	for _, item := range items {
+		if item.IsRemoved {
+			changes.Tombstones = append(changes.Tombstones, models.Tombstone{
+				ID:        item.ID,
+				ClientID:  item.ClientID,
+				Version:   item.Version,
+				DeletedAt: item.UpdatedAt,
+			})
+		} else {
+			changes.Items = append(changes.Items, item)
+		}
+		changes.NextToken = strconv.FormatInt(item.Revision, 10)
+	}
+
+	return changes, nil
+}
+
+// Apply applies a batch of offline mutations in order. Conflicts and invalid
+// mutations are reported per mutation and don't stop the batch.
+func (s *SyncService) Apply(ctx context.Context, userID int, batch models.SyncBatch) ([]models.SyncResult, error) {
+	if batch.Strategy == "" {
+		batch.Strategy = models.SyncLastWriterWins
+	}
+
+	if batch.Strategy != models.SyncLastWriterWins && batch.Strategy != models.SyncVersionCheck {
+		return nil, ErrInvalidSyncStrategy
+	}
+
+	results := make([]models.SyncResult, 0, len(batch.Mutations))
+	for _, mutation := range batch.Mutations {
+		var result models.SyncResult
+		var err error
+		switch mutation.Op {
+		case models.SyncOpCreate:
+			result, err = s.applyCreate(ctx, userID, mutation)
+		case models.SyncOpUpdate, models.SyncOpDelete:
+			result, err = s.applyChange(ctx, userID, batch.Strategy, mutation)
+		default:
+			result = rejected(mutation, "unknown op "+strconv.Quote(mutation.Op))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (s *SyncService) applyCreate(ctx context.Context, userID int, mutation models.SyncMutation) (models.SyncResult, error) {
+	if mutation.ClientID == "" {
+		return rejected(mutation, "client_id is required for create"), nil
+	}
+
+	// a retried create of an item the server already has is a no-op
+	item, err := s.repo.GetSyncItemByClientID(ctx, userID, mutation.ClientID)
+	if err == nil {
+		return replayed(mutation, item), nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.SyncResult{}, err
+	}
+
+	itemID, err := s.repo.Create(ctx, models.TodoItem{
+		Title:       mutation.Title,
+		Description: mutation.Description,
+		Done:        mutation.Done,
+		ClientID:    mutation.ClientID,
+		UserID:      userID,
+	})
+	if err != nil {
+		return models.SyncResult{}, err
+	}
+	metrics.ItemsCreated.Inc()
+
+	item, err = s.repo.GetSyncItem(ctx, userID, itemID)
+	if err != nil {
+		return models.SyncResult{}, err
+	}
+
+	return applied(mutation, item), nil
+}
+
+func (s *SyncService) applyChange(ctx context.Context, userID int, strategy string,
+	mutation models.SyncMutation) (models.SyncResult, error) {
+	current, err := s.findItem(ctx, userID, mutation)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return rejected(mutation, "item not found"), nil
+	}
+	if err != nil {
+		return models.SyncResult{}, err
+	}
+
+	if current.IsRemoved {
+		if mutation.Op == models.SyncOpDelete {
+			return replayed(mutation, current), nil
+		}
+		return conflict(mutation, current), nil
+	}
+
+	switch strategy {
+	case models.SyncVersionCheck:
+		if mutation.BaseVersion != current.Version {
+			return conflict(mutation, current), nil
+		}
+	case models.SyncLastWriterWins:
+		if !mutation.UpdatedAt.IsZero() && mutation.UpdatedAt.Before(current.UpdatedAt) {
+			return conflict(mutation, current), nil
+		}
+	}
+
+	change := current
+	if mutation.Op == models.SyncOpDelete {
+		change.IsRemoved = true
+	} else {
+		change.Title = mutation.Title
+		change.Description = mutation.Description
+		change.Done = mutation.Done
+	}
+
+	ok, err := s.repo.ApplySyncChange(ctx, userID, change, current.Version)
+	if err != nil {
+		return models.SyncResult{}, err
+	}
+
+	item, err := s.repo.GetSyncItem(ctx, userID, current.ID)
+	if err != nil {
+		return models.SyncResult{}, err
+	}
+
+	// the item was changed by someone else between the read and the write
+	if !ok {
+		return conflict(mutation, item), nil
+	}
+
+	return applied(mutation, item), nil
+}
+
+func (s *SyncService) findItem(ctx context.Context, userID int, mutation models.SyncMutation) (models.SyncItem, error) {
+	if mutation.ID != 0 {
+		return s.repo.GetSyncItem(ctx, userID, mutation.ID)
+	}
+
+	if mutation.ClientID != "" {
+		return s.repo.GetSyncItemByClientID(ctx, userID, mutation.ClientID)
+	}
+
+	return models.SyncItem{}, gorm.ErrRecordNotFound
+}
+
+func applied(mutation models.SyncMutation, item models.SyncItem) models.SyncResult {
+	return models.SyncResult{ClientID: mutation.ClientID, ID: item.ID, Status: models.SyncApplied, Item: &item, Changed: true}
+}
+
+// replayed reports a mutation the item already reflects as applied, without
+// writing it again.
+func replayed(mutation models.SyncMutation, item models.SyncItem) models.SyncResult {
+	return models.SyncResult{ClientID: mutation.ClientID, ID: item.ID, Status: models.SyncApplied, Item: &item}
+}
+
+func conflict(mutation models.SyncMutation, item models.SyncItem) models.SyncResult {
+	return models.SyncResult{ClientID: mutation.ClientID, ID: item.ID, Status: models.SyncConflict, Item: &item}
+}
+
+func rejected(mutation models.SyncMutation, reason string) models.SyncResult {
+	return models.SyncResult{ClientID: mutation.ClientID, ID: mutation.ID, Status: models.SyncRejected, Error: reason}
+}
@@ -1,42 +1,69 @@
 package service
 
 import (
+	"context"
 	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/metrics"
 	"github.com/NekruzRakhimov/todo_app/pkg/repository"
 )
 
 type TodoItemService struct {
 	repo repository.TodoItem
+	tx   repository.Transactor
 }
 
-func NewTodoItemService(repo repository.TodoItem) *TodoItemService {
-	return &TodoItemService{repo: repo}
+func NewTodoItemService(repo repository.TodoItem, tx repository.Transactor) *TodoItemService {
+	return &TodoItemService{repo: repo, tx: tx}
 }
 
-func (s *TodoItemService) Create(item models.TodoItem) (int, error) {
-	return s.repo.Create(item)
+func (s *TodoItemService) Create(ctx context.Context, item models.TodoItem) (int, error) {
+	id, err := s.repo.Create(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.ItemsCreated.Inc()
+	return id, nil
 }
 
-func (s *TodoItemService) BulkCreate(userID int, items []models.TodoItem) error {
-	return s.repo.BulkCreate(userID, items)
+// BulkCreate creates all of the items or, if one fails, none of them. It
+// returns the ids of the created items in the order of items.
+func (s *TodoItemService) BulkCreate(ctx context.Context, userID int, items []models.TodoItem) (ids []int, err error) {
+	err = s.tx.WithinTx(ctx, func(repos *repository.Repository) error {
+		ids, err = repos.TodoItem.BulkCreate(ctx, userID, items)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.ItemsCreated.Add(float64(len(items)))
+	return ids, nil
 }
 
-func (s *TodoItemService) GetAll(userID int) (items []models.TodoItem, err error) {
-	return s.repo.GetAll(userID)
+func (s *TodoItemService) GetAll(ctx context.Context, userID int) (items []models.TodoItem, err error) {
+	return s.repo.GetAll(ctx, userID)
 }
 
-func (s *TodoItemService) GetByID(userID, itemID int) (models.TodoItem, error) {
-	return s.repo.GetByID(userID, itemID)
+func (s *TodoItemService) GetByID(ctx context.Context, userID, itemID int) (models.TodoItem, error) {
+	return s.repo.GetByID(ctx, userID, itemID)
 }
 
-func (s *TodoItemService) Delete(userID, itemID int) error {
-	return s.repo.Delete(userID, itemID)
+func (s *TodoItemService) Delete(ctx context.Context, userID, itemID int) error {
+	return s.repo.Delete(ctx, userID, itemID)
 }
 
-func (s *TodoItemService) Update(userID, itemID int, input models.TodoItem) error {
-	return s.repo.Update(userID, itemID, input)
+func (s *TodoItemService) Update(ctx context.Context, userID, itemID int, input models.TodoItem) error {
+	return s.repo.Update(ctx, userID, itemID, input)
 }
 
-func (s *TodoItemService) ChangeStatus(userID, itemID int, status bool) error {
-	return s.repo.ChangeStatus(userID, itemID, status)
+func (s *TodoItemService) ChangeStatus(ctx context.Context, userID, itemID int, status bool) error {
+	if err := s.repo.ChangeStatus(ctx, userID, itemID, status); err != nil {
+		return err
+	}
+
+	if status {
+		metrics.ItemsCompleted.Inc()
+	}
+	return nil
 }
@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"io"
+	"time"
+)
+
+// tracedTodoItem runs each TodoItem call in a span.
+type tracedTodoItem struct {
+	next TodoItem
+}
+
+func (t tracedTodoItem) Create(ctx context.Context, item models.TodoItem) (id int, err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.Create")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Create(ctx, item)
+}
+
+func (t tracedTodoItem) BulkCreate(ctx context.Context, userID int, items []models.TodoItem) (ids []int, err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.BulkCreate")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.BulkCreate(ctx, userID, items)
+}
+
+func (t tracedTodoItem) GetAll(ctx context.Context, userID int) (items []models.TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetAll(ctx, userID)
+}
+
+func (t tracedTodoItem) GetByID(ctx context.Context, userID, itemID int) (item models.TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.GetByID")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetByID(ctx, userID, itemID)
+}
+
+func (t tracedTodoItem) Delete(ctx context.Context, userID, itemID int) (err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Delete(ctx, userID, itemID)
+}
+
+func (t tracedTodoItem) Update(ctx context.Context, userID, itemID int, input models.TodoItem) (err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.Update")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Update(ctx, userID, itemID, input)
+}
+
+func (t tracedTodoItem) ChangeStatus(ctx context.Context, userID, itemID int, status bool) (err error) {
+	ctx, span := tracing.Start(ctx, "TodoItem.ChangeStatus")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ChangeStatus(ctx, userID, itemID, status)
+}
+
+// tracedSync runs each Sync call in a span.
+type tracedSync struct {
+	next Sync
+}
+
+func (t tracedSync) GetChanges(ctx context.Context, userID int, token string) (changes models.SyncChanges, err error) {
+	ctx, span := tracing.Start(ctx, "Sync.GetChanges")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetChanges(ctx, userID, token)
+}
+
+func (t tracedSync) Apply(ctx context.Context, userID int, batch models.SyncBatch) (results []models.SyncResult, err error) {
+	ctx, span := tracing.Start(ctx, "Sync.Apply")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Apply(ctx, userID, batch)
+}
+
+// tracedAuthorization runs each Authorization call in a span.
+type tracedAuthorization struct {
+	next Authorization
+}
+
+func (t tracedAuthorization) CreateUser(ctx context.Context, user models.User) (id int, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.CreateUser(ctx, user)
+}
+
+func (t tracedAuthorization) UsernameAvailable(ctx context.Context, username string) (ok bool, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.UsernameAvailable")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.UsernameAvailable(ctx, username)
+}
+
+func (t tracedAuthorization) GenerateToken(ctx context.Context,
+	username, password, ip string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.GenerateToken")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GenerateToken(ctx, username, password, ip)
+}
+
+func (t tracedAuthorization) SignIn(ctx context.Context,
+	username, password, ip string) (result models.SignInResult, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.SignIn")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.SignIn(ctx, username, password, ip)
+}
+
+func (t tracedAuthorization) VerifyTwoFactor(ctx context.Context,
+	challengeToken, code, ip string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.VerifyTwoFactor")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.VerifyTwoFactor(ctx, challengeToken, code, ip)
+}
+
+func (t tracedAuthorization) ParseToken(ctx context.Context, token string) (identity models.Identity, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.ParseToken")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ParseToken(ctx, token)
+}
+
+// IssueStreamToken only signs a token, so it gets no span.
+func (t tracedAuthorization) IssueStreamToken(userID int) (models.StreamToken, error) {
+	return t.next.IssueStreamToken(userID)
+}
+
+func (t tracedAuthorization) ParseStreamToken(ctx context.Context, token string) (identity models.Identity, err error) {
+	ctx, span := tracing.Start(ctx, "Authorization.ParseStreamToken")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ParseStreamToken(ctx, token)
+}
+
+// tracedAccount runs each Account call in a span.
+type tracedAccount struct {
+	next Account
+}
+
+func (t tracedAccount) ForgotPassword(ctx context.Context, email string) (err error) {
+	ctx, span := tracing.Start(ctx, "Account.ForgotPassword")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ForgotPassword(ctx, email)
+}
+
+func (t tracedAccount) ResetPassword(ctx context.Context, token, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "Account.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ResetPassword(ctx, token, password)
+}
+
+func (t tracedAccount) SendVerificationEmail(ctx context.Context, userID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Account.SendVerificationEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.SendVerificationEmail(ctx, userID)
+}
+
+func (t tracedAccount) VerifyEmail(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "Account.VerifyEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.VerifyEmail(ctx, token)
+}
+
+// tracedTwoFactor runs each TwoFactor call in a span.
+type tracedTwoFactor struct {
+	next TwoFactor
+}
+
+func (t tracedTwoFactor) Enroll(ctx context.Context, userID int) (enrollment models.TwoFactorEnrollment, err error) {
+	ctx, span := tracing.Start(ctx, "TwoFactor.Enroll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Enroll(ctx, userID)
+}
+
+func (t tracedTwoFactor) Confirm(ctx context.Context, userID int, code string) (codes []string, err error) {
+	ctx, span := tracing.Start(ctx, "TwoFactor.Confirm")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Confirm(ctx, userID, code)
+}
+
+func (t tracedTwoFactor) Disable(ctx context.Context, userID int, code string) (err error) {
+	ctx, span := tracing.Start(ctx, "TwoFactor.Disable")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Disable(ctx, userID, code)
+}
+
+// tracedAccessToken runs each AccessToken call in a span.
+type tracedAccessToken struct {
+	next AccessToken
+}
+
+func (t tracedAccessToken) Create(ctx context.Context, userID int,
+	input models.PersonalAccessTokenInput) (token models.PersonalAccessToken, err error) {
+	ctx, span := tracing.Start(ctx, "AccessToken.Create")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Create(ctx, userID, input)
+}
+
+func (t tracedAccessToken) GetAll(ctx context.Context, userID int) (tokens []models.PersonalAccessToken, err error) {
+	ctx, span := tracing.Start(ctx, "AccessToken.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetAll(ctx, userID)
+}
+
+func (t tracedAccessToken) Revoke(ctx context.Context, userID, tokenID int) (err error) {
+	ctx, span := tracing.Start(ctx, "AccessToken.Revoke")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Revoke(ctx, userID, tokenID)
+}
+
+func (t tracedAccessToken) Authenticate(ctx context.Context,
+	token string) (result models.PersonalAccessToken, err error) {
+	ctx, span := tracing.Start(ctx, "AccessToken.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Authenticate(ctx, token)
+}
+
+// tracedAdmin runs each Admin call in a span.
+type tracedAdmin struct {
+	next Admin
+}
+
+func (t tracedAdmin) ListUsers(ctx context.Context, actorID int, ip, search string,
+	limit, offset int) (list models.AdminUserList, err error) {
+	ctx, span := tracing.Start(ctx, "Admin.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ListUsers(ctx, actorID, ip, search, limit, offset)
+}
+
+func (t tracedAdmin) GetUser(ctx context.Context, actorID int, ip string,
+	userID int) (user models.AdminUser, err error) {
+	ctx, span := tracing.Start(ctx, "Admin.GetUser")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetUser(ctx, actorID, ip, userID)
+}
+
+func (t tracedAdmin) SetDisabled(ctx context.Context, actorID int, ip string, userID int, disabled bool) (err error) {
+	ctx, span := tracing.Start(ctx, "Admin.SetDisabled")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.SetDisabled(ctx, actorID, ip, userID, disabled)
+}
+
+func (t tracedAdmin) DeleteUser(ctx context.Context, actorID int, ip string, userID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Admin.DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.DeleteUser(ctx, actorID, ip, userID)
+}
+
+func (t tracedAdmin) ForcePasswordReset(ctx context.Context, actorID int, ip string, userID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Admin.ForcePasswordReset")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ForcePasswordReset(ctx, actorID, ip, userID)
+}
+
+// tracedProfile runs each Profile call in a span.
+type tracedProfile struct {
+	next Profile
+}
+
+func (t tracedProfile) Get(ctx context.Context, userID int) (profile models.Profile, err error) {
+	ctx, span := tracing.Start(ctx, "Profile.Get")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Get(ctx, userID)
+}
+
+func (t tracedProfile) Update(ctx context.Context, userID int,
+	input models.ProfileUpdateInput) (profile models.Profile, err error) {
+	ctx, span := tracing.Start(ctx, "Profile.Update")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Update(ctx, userID, input)
+}
+
+func (t tracedProfile) ChangePassword(ctx context.Context, userID int,
+	currentPassword, newPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "Profile.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ChangePassword(ctx, userID, currentPassword, newPassword)
+}
+
+func (t tracedProfile) ScheduleDeletion(ctx context.Context, userID int,
+	password string) (deleteAfter time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "Profile.ScheduleDeletion")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.ScheduleDeletion(ctx, userID, password)
+}
+
+func (t tracedProfile) CancelDeletion(ctx context.Context, userID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Profile.CancelDeletion")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.CancelDeletion(ctx, userID)
+}
+
+func (t tracedProfile) Purge(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "Profile.Purge")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Purge(ctx)
+}
+
+// tracedExport runs each Export call in a span.
+type tracedExport struct {
+	next Export
+}
+
+func (t tracedExport) Request(ctx context.Context, userID int) (export models.DataExport, err error) {
+	ctx, span := tracing.Start(ctx, "Export.Request")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Request(ctx, userID)
+}
+
+func (t tracedExport) GetAll(ctx context.Context, userID int) (exports []models.DataExport, err error) {
+	ctx, span := tracing.Start(ctx, "Export.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetAll(ctx, userID)
+}
+
+func (t tracedExport) GetByID(ctx context.Context, userID, exportID int) (export models.DataExport, err error) {
+	ctx, span := tracing.Start(ctx, "Export.GetByID")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetByID(ctx, userID, exportID)
+}
+
+func (t tracedExport) Open(ctx context.Context, exportID int, expires int64,
+	signature string) (file io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "Export.Open")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Open(ctx, exportID, expires, signature)
+}
+
+func (t tracedExport) Cleanup(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "Export.Cleanup")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Cleanup(ctx)
+}
+
+// tracedWebhook runs each Webhook call in a span.
+type tracedWebhook struct {
+	next Webhook
+}
+
+func (t tracedWebhook) Create(ctx context.Context, userID int,
+	input models.WebhookInput) (webhook models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.Create")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Create(ctx, userID, input)
+}
+
+func (t tracedWebhook) GetAll(ctx context.Context, userID int) (webhooks []models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetAll(ctx, userID)
+}
+
+func (t tracedWebhook) GetByID(ctx context.Context, userID, webhookID int) (webhook models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.GetByID")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetByID(ctx, userID, webhookID)
+}
+
+func (t tracedWebhook) Delete(ctx context.Context, userID, webhookID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Delete(ctx, userID, webhookID)
+}
+
+func (t tracedWebhook) GetDeliveries(ctx context.Context,
+	userID, webhookID int) (deliveries []models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.GetDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetDeliveries(ctx, userID, webhookID)
+}
+
+func (t tracedWebhook) GetDeliveryByID(ctx context.Context,
+	userID, webhookID, deliveryID int) (delivery models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.GetDeliveryByID")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.GetDeliveryByID(ctx, userID, webhookID, deliveryID)
+}
+
+func (t tracedWebhook) Redeliver(ctx context.Context, userID, webhookID, deliveryID int) (id int, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.Redeliver")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Redeliver(ctx, userID, webhookID, deliveryID)
+}
+
+func (t tracedWebhook) Dispatch(ctx context.Context, userID int, event string, data interface{}) {
+	ctx, span := tracing.Start(ctx, "Webhook.Dispatch")
+	defer tracing.End(span, nil)
+
+	t.next.Dispatch(ctx, userID, event, data)
+}
+
+func (t tracedWebhook) RetryDue(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.RetryDue")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.RetryDue(ctx)
+}
+
+// tracedIdempotency runs each Idempotency call in a span.
+type tracedIdempotency struct {
+	next Idempotency
+}
+
+func (t tracedIdempotency) Begin(ctx context.Context, userID int,
+	key, requestHash string) (record models.IdempotencyRecord, err error) {
+	ctx, span := tracing.Start(ctx, "Idempotency.Begin")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Begin(ctx, userID, key, requestHash)
+}
+
+func (t tracedIdempotency) Complete(ctx context.Context, record models.IdempotencyRecord) (err error) {
+	ctx, span := tracing.Start(ctx, "Idempotency.Complete")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Complete(ctx, record)
+}
+
+func (t tracedIdempotency) Release(ctx context.Context, record models.IdempotencyRecord) (err error) {
+	ctx, span := tracing.Start(ctx, "Idempotency.Release")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Release(ctx, record)
+}
+
+// tracedRateLimit runs each RateLimit call in a span.
+type tracedRateLimit struct {
+	next RateLimit
+}
+
+// Rule only reads the configuration, so it gets no span.
+func (t tracedRateLimit) Rule(group string) (RateLimitRule, bool) {
+	return t.next.Rule(group)
+}
+
+func (t tracedRateLimit) Allow(ctx context.Context, group, key string) (result models.RateLimitResult, err error) {
+	ctx, span := tracing.Start(ctx, "RateLimit.Allow")
+	defer func() { tracing.End(span, err) }()
+
+	return t.next.Allow(ctx, group, key)
+}
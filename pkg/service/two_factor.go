@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrollment hasn't been started")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+type TwoFactorConfig struct {
+	// Issuer is shown next to the account name in authenticator apps.
+	Issuer string
+	// ChallengeTTL is how long the sign-in challenge token is valid for.
+	ChallengeTTL time.Duration
+}
+
+type TwoFactorService struct {
+	repo  repository.TwoFactor
+	users repository.Authorization
+	cfg   TwoFactorConfig
+}
+
+func NewTwoFactorService(repo repository.TwoFactor, users repository.Authorization, cfg TwoFactorConfig) *TwoFactorService {
+	return &TwoFactorService{repo: repo, users: users, cfg: cfg}
+}
+
+// Enroll generates a new secret for the user. 2FA isn't enabled until the
+// secret is confirmed with a code.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int) (models.TwoFactorEnrollment, error) {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	if tf.Enabled {
+		return models.TwoFactorEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	if err = s.repo.SetSecret(ctx, userID, secret); err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	return models.TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totpURI(s.cfg.Issuer, user.Username, secret),
+	}, nil
+}
+
+// Confirm enables 2FA once the user proves their authenticator works and
+// returns the recovery codes. They are only stored hashed, so this is the
+// only time they can be shown.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tf.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if tf.Secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok, err := matchTOTP(tf.Secret, normalizeCode(code), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(normalizeCode(codes[i]))
+	}
+
+	if err = s.repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns 2FA off. It asks for a current code or a recovery code so a
+// stolen access token alone can't remove it.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.repo.Disable(ctx, userID)
+}
+
+// Verify accepts a TOTP code or an unused recovery code. A TOTP code can
+// only be used once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID int, code string) error {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !tf.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+	step, ok, err := matchTOTP(tf.Secret, code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		if step <= tf.LastStep {
+			return ErrInvalidTwoFactorCode
+		}
+
+		updated, err := s.repo.UpdateLastStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+
+		if !updated {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (s *TwoFactorService) Enabled(ctx context.Context, userID int) (bool, error) {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tf.Enabled, nil
+}
+
+// generateRecoveryCode returns a code like "k3m7q-x5t2p" with 50 bits of entropy.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	code := make([]byte, 0, 11)
+	for i, c := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, alphabet[int(c)%len(alphabet)])
+	}
+
+	return string(code), nil
+}
+
+// normalizeCode strips the spaces and dashes people type into codes.
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/NekruzRakhimov/todo_app/pkg/repository"
+	"github.com/NekruzRakhimov/todo_app/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookEventHeader     = "X-Todo-Event"
+	webhookDeliveryHeader  = "X-Todo-Delivery"
+	webhookTimestampHeader = "X-Todo-Timestamp"
+	webhookSignatureHeader = "X-Todo-Signature"
+
+	// webhookDeliveryLease hides a delivery handed to the job runner from
+	// RetryDue, so it isn't sent twice. If the process exits before the
+	// attempt is made, the delivery is retried once the lease expires.
+	webhookDeliveryLease = 5 * time.Minute
+	webhookRetryBatch    = 100
+)
+
+var (
+	ErrInvalidWebhookURL       = errors.New("webhook url must be an absolute https url")
+	ErrInvalidWebhookEvent     = errors.New("unknown webhook event")
+	ErrWebhookAddressForbidden = errors.New("webhook url must not point to a loopback, link-local or private address")
+)
+
+var webhookEvents = map[string]bool{
+	models.EventItemCreated:   true,
+	models.EventItemUpdated:   true,
+	models.EventItemCompleted: true,
+	models.EventItemDeleted:   true,
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// AllowInsecure permits plain http callback URLs, for local development only.
+	AllowInsecure bool
+	// AllowPrivateNetworks permits callback URLs resolving to loopback,
+	// link-local or private addresses, for local development only.
+	AllowPrivateNetworks bool
+}
+
+type WebhookService struct {
+	repo   repository.Webhook
+	runner *jobs.Runner
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func NewWebhookService(repo repository.Webhook, runner *jobs.Runner, cfg WebhookConfig) *WebhookService {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &WebhookService{
+		repo:   repo,
+		runner: runner,
+		cfg:    cfg,
+		client: newWebhookClient(cfg),
+	}
+}
+
+// newWebhookClient returns a client that refuses to connect to the addresses
+// validateURL rejects. The check runs on the address being dialed, so a host
+// re-resolving to an internal address after registration is caught too.
+// There is no proxy, which would hide that address.
+func newWebhookClient(cfg WebhookConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressForbidden, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *WebhookService) Create(ctx context.Context, userID int, input models.WebhookInput) (models.Webhook, error) {
+	if err := s.validateURL(ctx, input.URL); err != nil {
+		return models.Webhook{}, err
+	}
+
+	if len(input.Events) == 0 {
+		return models.Webhook{}, ErrInvalidWebhookEvent
+	}
+
+	for _, event := range input.Events {
+		if !webhookEvents[event] {
+			return models.Webhook{}, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	webhook := models.Webhook{
+		UserID:   userID,
+		URL:      input.URL,
+		Secret:   secret,
+		Events:   input.Events,
+		IsActive: true,
+	}
+
+	webhook.ID, err = s.repo.Create(ctx, webhook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookService) GetAll(ctx context.Context, userID int) ([]models.Webhook, error) {
+	webhooks, err := s.repo.GetAll(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the secret is only revealed once, when the webhook is created
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetByID(ctx context.Context, userID, webhookID int) (models.Webhook, error) {
+	webhook, err := s.repo.GetByID(ctx, userID, webhookID)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, userID, webhookID int) error {
+	return s.repo.Delete(ctx, userID, webhookID)
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID int) ([]models.WebhookDelivery, error) {
+	return s.repo.GetDeliveries(ctx, userID, webhookID)
+}
+
+func (s *WebhookService) GetDeliveryByID(ctx context.Context, userID, webhookID, deliveryID int) (models.WebhookDelivery, error) {
+	return s.repo.GetDeliveryByID(ctx, userID, webhookID, deliveryID)
+}
+
+// Redeliver sends the payload of an earlier delivery again, recording it as a new delivery.
+func (s *WebhookService) Redeliver(ctx context.Context, userID, webhookID, deliveryID int) (int, error) {
+	webhook, err := s.repo.GetByID(ctx, userID, webhookID)
+	if err != nil {
+		return 0, err
+	}
+
+	previous, err := s.repo.GetDeliveryByID(ctx, userID, webhookID, deliveryID)
+	if err != nil {
+		return 0, err
+	}
+
+	delivery, err := s.createDelivery(ctx, webhook, previous.Event, previous.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	s.enqueue(ctx, webhook, delivery)
+
+	return delivery.ID, nil
+}
+
+// Dispatch delivers the event to every active webhook of the user subscribed to it.
+// Deliveries run on the job runner, so failures are only logged.
+func (s *WebhookService) Dispatch(ctx context.Context, userID int, event string, data interface{}) {
+	ctx = tracing.Detach(ctx)
+	err := s.runner.Enqueue("webhook dispatch "+event, func() error {
+		webhooks, err := s.repo.GetActiveByEvent(ctx, userID, event)
+		if err != nil {
+			return fmt.Errorf("couldn't get webhooks for event %s: %w", event, err)
+		}
+
+		if len(webhooks) == 0 {
+			return nil
+		}
+
+		payload, err := json.Marshal(models.WebhookEvent{
+			Event:     event,
+			CreatedAt: time.Now().UTC(),
+			Data:      data,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't marshal webhook payload for event %s: %w", event, err)
+		}
+
+		for _, webhook := range webhooks {
+			delivery, err := s.createDelivery(ctx, webhook, event, string(payload))
+			if err != nil {
+				logrus.Errorf("couldn't create delivery for webhook %d: %s", webhook.ID, err.Error())
+				continue
+			}
+
+			s.enqueue(ctx, webhook, delivery)
+		}
+
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("couldn't queue webhooks for event %s: %s", event, err.Error())
+	}
+}
+
+// RetryDue queues the pending deliveries whose next attempt is due. The
+// server runs it periodically, so retries survive a restart.
+func (s *WebhookService) RetryDue(ctx context.Context) error {
+	deliveries, err := s.repo.ClaimDueDeliveries(ctx, webhookRetryBatch, webhookDeliveryLease)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := s.repo.GetActiveByID(ctx, delivery.WebhookID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			delivery.Status = models.DeliveryFailed
+			delivery.LastError = "webhook is disabled"
+			delivery.NextAttemptAt = nil
+			if err = s.repo.UpdateDelivery(ctx, delivery); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		s.enqueue(ctx, webhook, delivery)
+	}
+
+	return nil
+}
+
+func (s *WebhookService) createDelivery(ctx context.Context, webhook models.Webhook, event, payload string) (models.WebhookDelivery, error) {
+	lease := time.Now().Add(webhookDeliveryLease)
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &lease,
+	}
+
+	id, err := s.repo.CreateDelivery(ctx, delivery)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery.ID = id
+	return delivery, nil
+}
+
+// enqueue makes the next attempt of the delivery on the job runner. If the
+// queue is full the attempt is left to RetryDue once the lease expires.
+func (s *WebhookService) enqueue(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) {
+	ctx = tracing.Detach(ctx)
+	err := s.runner.Enqueue(fmt.Sprintf("webhook delivery %d", delivery.ID), func() error {
+		return s.attempt(ctx, webhook, delivery)
+	})
+	if err != nil {
+		logrus.Warnf("couldn't queue webhook delivery %d, it will be retried later: %s", delivery.ID, err.Error())
+	}
+}
+
+// attempt sends the delivery once. A failed attempt is scheduled again with
+// exponential backoff until the configured number of attempts is used up.
+func (s *WebhookService) attempt(ctx context.Context, webhook models.Webhook,
+	delivery models.WebhookDelivery) (err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.attempt")
+	defer func() { tracing.End(span, err) }()
+
+	delivery.Attempts++
+	code, err := s.send(ctx, webhook, delivery)
+	delivery.ResponseCode = code
+	delivery.NextAttemptAt = nil
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= s.cfg.MaxAttempts {
+			delivery.Status = models.DeliveryFailed
+		} else {
+			next := time.Now().Add(s.backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err = s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("couldn't update webhook delivery %d: %w", delivery.ID, err)
+	}
+
+	return nil
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	backoff := s.cfg.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if s.cfg.MaxBackoff > 0 && backoff > s.cfg.MaxBackoff {
+			return s.cfg.MaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+func (s *WebhookService) send(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo_app-webhooks")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookService) validateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	if u.Scheme != "https" && (u.Scheme != "http" || !s.cfg.AllowInsecure) {
+		return ErrInvalidWebhookURL
+	}
+
+	if s.cfg.AllowPrivateNetworks {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhookURL, err.Error())
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return ErrWebhookAddressForbidden
+		}
+	}
+
+	return nil
+}
+
+// isPublicIP reports whether ip may be reached by webhook deliveries.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsMulticast() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// SignWebhookPayload returns the value of the signature header receivers use to
+// verify a delivery: hex HMAC-SHA256 of "<timestamp>.<payload>" keyed by the webhook secret.
+func SignWebhookPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
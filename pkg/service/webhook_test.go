@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/NekruzRakhimov/todo_app/models"
+	"github.com/NekruzRakhimov/todo_app/pkg/jobs"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookRepo keeps webhooks and their deliveries in memory.
+type webhookRepo struct {
+	mu         sync.Mutex
+	webhooks   map[int]models.Webhook
+	deliveries map[int]models.WebhookDelivery
+	nextID     int
+}
+
+func newWebhookRepo() *webhookRepo {
+	return &webhookRepo{webhooks: map[int]models.Webhook{}, deliveries: map[int]models.WebhookDelivery{}}
+}
+
+func (r *webhookRepo) Create(ctx context.Context, webhook models.Webhook) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	webhook.ID = r.nextID
+	r.webhooks[webhook.ID] = webhook
+	return webhook.ID, nil
+}
+
+func (r *webhookRepo) GetAll(ctx context.Context, userID int) ([]models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, webhook := range r.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepo) GetByID(ctx context.Context, userID, webhookID int) (models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[webhookID]
+	if !ok || webhook.UserID != userID {
+		return models.Webhook{}, gorm.ErrRecordNotFound
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepo) GetActiveByID(ctx context.Context, webhookID int) (models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[webhookID]
+	if !ok || !webhook.IsActive {
+		return models.Webhook{}, gorm.ErrRecordNotFound
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepo) GetActiveByEvent(ctx context.Context, userID int, event string) ([]models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, webhook := range r.webhooks {
+		if webhook.UserID != userID || !webhook.IsActive {
+			continue
+		}
+		for _, e := range webhook.Events {
+			if e == event {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepo) Delete(ctx context.Context, userID, webhookID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.webhooks, webhookID)
+	return nil
+}
+
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	delivery.ID = r.nextID
+	delivery.CreatedAt = time.Now()
+	r.deliveries[delivery.ID] = delivery
+	return delivery.ID, nil
+}
+
+func (r *webhookRepo) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (r *webhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []models.WebhookDelivery
+	now := time.Now()
+	for id, delivery := range r.deliveries {
+		if len(due) == limit {
+			break
+		}
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt == nil ||
+			delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		next := now.Add(lease)
+		delivery.NextAttemptAt = &next
+		r.deliveries[id] = delivery
+		due = append(due, delivery)
+	}
+	return due, nil
+}
+
+func (r *webhookRepo) GetDeliveries(ctx context.Context, userID, webhookID int) ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepo) GetDeliveryByID(ctx context.Context, userID, webhookID, deliveryID int) (models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[deliveryID]
+	if !ok || delivery.WebhookID != webhookID {
+		return models.WebhookDelivery{}, gorm.ErrRecordNotFound
+	}
+	return delivery, nil
+}
+
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+func TestWebhookService_DeliversSignedPayloadAndRetries(t *testing.T) {
+	ctx := context.Background()
+	requests := make(chan webhookRequest, 10)
+	var calls atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header.Clone(), body: string(body)}
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	runner := jobs.NewRunner(1, 10)
+	defer runner.Shutdown(ctx)
+
+	repo := newWebhookRepo()
+	s := NewWebhookService(repo, runner, WebhookConfig{
+		MaxAttempts:          3,
+		InitialBackoff:       10 * time.Millisecond,
+		MaxBackoff:           time.Second,
+		Timeout:              5 * time.Second,
+		AllowPrivateNetworks: true,
+	})
+	s.client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	webhook, err := s.Create(ctx, 1, models.WebhookInput{URL: server.URL, Events: []string{models.EventItemCreated}})
+	require.NoError(t, err)
+
+	s.Dispatch(ctx, 1, models.EventItemCreated, map[string]interface{}{"id": 7})
+
+	first := receive(t, requests)
+	require.Equal(t, models.EventItemCreated, first.header.Get(webhookEventHeader))
+	require.Equal(t, SignWebhookPayload(webhook.Secret, first.header.Get(webhookTimestampHeader), first.body),
+		first.header.Get(webhookSignatureHeader))
+
+	delivery := waitForDelivery(t, repo, func(d models.WebhookDelivery) bool { return d.Attempts == 1 })
+	require.Equal(t, models.DeliveryPending, delivery.Status)
+	require.Equal(t, http.StatusInternalServerError, delivery.ResponseCode)
+	require.NotEmpty(t, delivery.LastError)
+	require.NotNil(t, delivery.NextAttemptAt)
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, s.RetryDue(ctx))
+
+	second := receive(t, requests)
+	require.Equal(t, first.body, second.body)
+	require.Equal(t, SignWebhookPayload(webhook.Secret, second.header.Get(webhookTimestampHeader), second.body),
+		second.header.Get(webhookSignatureHeader))
+
+	delivery = waitForDelivery(t, repo, func(d models.WebhookDelivery) bool { return d.Status != models.DeliveryPending })
+	require.Equal(t, models.DeliverySucceeded, delivery.Status)
+	require.Equal(t, 2, delivery.Attempts)
+	require.Equal(t, http.StatusNoContent, delivery.ResponseCode)
+	require.Empty(t, delivery.LastError)
+	require.NotNil(t, delivery.DeliveredAt)
+	require.Nil(t, delivery.NextAttemptAt)
+}
+
+func TestWebhookService_RejectsPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook reached a loopback address")
+	}))
+	defer server.Close()
+
+	runner := jobs.NewRunner(1, 10)
+	defer runner.Shutdown(ctx)
+
+	repo := newWebhookRepo()
+	s := NewWebhookService(repo, runner, WebhookConfig{MaxAttempts: 1, Timeout: 5 * time.Second})
+	s.client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	for _, url := range []string{server.URL, "https://localhost/hook", "https://10.0.0.1/hook",
+		"https://169.254.169.254/latest", "https://[::1]/hook"} {
+		_, err := s.Create(ctx, 1, models.WebhookInput{URL: url, Events: []string{models.EventItemCreated}})
+		require.True(t, errors.Is(err, ErrWebhookAddressForbidden), "%s: %v", url, err)
+	}
+
+	// a webhook registered before its host resolved to a loopback address
+	webhook := models.Webhook{ID: 1, UserID: 1, URL: server.URL, Secret: "secret", IsActive: true}
+	_, err := s.send(ctx, webhook, models.WebhookDelivery{ID: 1, Event: models.EventItemCreated, Payload: "{}"})
+	require.True(t, errors.Is(err, ErrWebhookAddressForbidden), "%v", err)
+}
+
+func receive(t *testing.T, requests <-chan webhookRequest) webhookRequest {
+	t.Helper()
+
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+		return webhookRequest{}
+	}
+}
+
+func waitForDelivery(t *testing.T, repo *webhookRepo, done func(models.WebhookDelivery) bool) models.WebhookDelivery {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, _ := repo.GetDeliveries(context.Background(), 1, 1)
+		if len(deliveries) == 1 && done(deliveries[0]) {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("delivery didn't reach the expected state")
+	return models.WebhookDelivery{}
+}
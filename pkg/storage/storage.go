@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("artifact not found")
+	ErrInvalidKey = errors.New("invalid artifact key")
+)
+
+// Store keeps generated artifacts such as data exports. Keys are slash
+// separated paths like "exports/1/2.zip".
+type Store interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	// DeleteAll removes every artifact whose key starts with prefix + "/".
+	DeleteAll(prefix string) error
+}
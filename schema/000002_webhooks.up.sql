@@ -0,0 +1,24 @@
+CREATE TABLE webhooks
+(
+    id         serial primary key                          not null unique,
+    user_id    int references users (id) on delete cascade not null,
+    url        varchar(2048)                               not null,
+    secret     varchar(255)                                not null,
+    events     text[]                                      not null,
+    is_active  boolean                                     not null default true,
+    created_at timestamp                                   not null default now()
+);
+
+CREATE TABLE webhook_deliveries
+(
+    id            serial primary key                             not null unique,
+    webhook_id    int references webhooks (id) on delete cascade not null,
+    event         varchar(64)                                    not null,
+    payload       text                                           not null,
+    status        varchar(16)                                    not null default 'pending',
+    attempts      int                                            not null default 0,
+    response_code int,
+    last_error    text,
+    created_at    timestamp                                      not null default now(),
+    delivered_at  timestamp
+);
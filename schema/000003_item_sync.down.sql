@@ -0,0 +1,12 @@
+DROP TRIGGER todo_items_bump_revision ON todo_items;
+
+DROP FUNCTION todo_items_bump_revision();
+
+ALTER TABLE todo_items
+    DROP COLUMN client_id,
+    DROP COLUMN version,
+    DROP COLUMN revision,
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
+
+DROP SEQUENCE todo_items_revision_seq;
@@ -0,0 +1,28 @@
+CREATE SEQUENCE todo_items_revision_seq;
+
+ALTER TABLE todo_items
+    ADD COLUMN client_id  varchar(64),
+    ADD COLUMN version    int       not null default 1,
+    ADD COLUMN revision   bigint    not null default nextval('todo_items_revision_seq'),
+    ADD COLUMN created_at timestamp not null default now(),
+    ADD COLUMN updated_at timestamp not null default now();
+
+CREATE UNIQUE INDEX todo_items_user_client_id_idx ON todo_items (user_id, client_id) WHERE client_id IS NOT NULL;
+
+CREATE INDEX todo_items_user_revision_idx ON todo_items (user_id, revision);
+
+CREATE FUNCTION todo_items_bump_revision() RETURNS trigger AS
+$$
+BEGIN
+    NEW.version := OLD.version + 1;
+    NEW.revision := nextval('todo_items_revision_seq');
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todo_items_bump_revision
+    BEFORE UPDATE
+    ON todo_items
+    FOR EACH ROW
+EXECUTE PROCEDURE todo_items_bump_revision();
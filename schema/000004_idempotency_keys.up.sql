@@ -0,0 +1,15 @@
+CREATE TABLE idempotency_keys
+(
+    user_id       int references users (id) on delete cascade not null,
+    key           varchar(255)                                not null,
+    request_hash  varchar(64)                                 not null,
+    completed     boolean                                     not null default false,
+    status_code   int                                         not null default 0,
+    content_type  varchar(255)                                not null default '',
+    response_body bytea,
+    created_at    timestamp                                   not null default now(),
+    expires_at    timestamp                                   not null,
+    primary key (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
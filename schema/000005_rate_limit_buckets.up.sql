@@ -0,0 +1,7 @@
+CREATE TABLE rate_limit_buckets
+(
+    key        varchar(255) primary key not null,
+    tokens     double precision         not null,
+    allowed    boolean                  not null default true,
+    updated_at timestamp                not null default now()
+);
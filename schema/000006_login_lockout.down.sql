@@ -0,0 +1,3 @@
+DROP TABLE auth_audit_log;
+
+DROP TABLE login_attempts;
@@ -0,0 +1,21 @@
+CREATE TABLE login_attempts
+(
+    key             varchar(320) primary key not null,
+    failures        int                      not null default 0,
+    lockouts        int                      not null default 0,
+    last_failure_at timestamptz              not null default now(),
+    locked_until    timestamptz
+);
+
+CREATE TABLE auth_audit_log
+(
+    id         serial primary key not null unique,
+    user_id    int references users (id) on delete set null,
+    username   varchar(255)       not null default '',
+    ip         varchar(64)        not null default '',
+    event      varchar(64)        not null,
+    details    text               not null default '',
+    created_at timestamptz        not null default now()
+);
+
+CREATE INDEX auth_audit_log_user_id_idx ON auth_audit_log (user_id);
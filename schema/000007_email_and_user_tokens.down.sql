@@ -0,0 +1,7 @@
+DROP TABLE user_tokens;
+
+DROP INDEX users_email_idx;
+
+ALTER TABLE users
+    DROP COLUMN email,
+    DROP COLUMN email_verified;
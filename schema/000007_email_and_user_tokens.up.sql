@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN email          varchar(255),
+    ADD COLUMN email_verified boolean not null default false;
+
+CREATE UNIQUE INDEX users_email_idx ON users (lower(email)) WHERE email IS NOT NULL;
+
+CREATE TABLE user_tokens
+(
+    id         serial primary key                          not null unique,
+    user_id    int references users (id) on delete cascade not null,
+    purpose    varchar(32)                                 not null,
+    token_hash varchar(64)                                 not null unique,
+    expires_at timestamptz                                 not null,
+    used_at    timestamptz,
+    created_at timestamptz                                 not null default now()
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose);
@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret    varchar(64),
+    ADD COLUMN totp_enabled   boolean not null default false,
+    ADD COLUMN totp_last_step bigint  not null default 0;
+
+CREATE TABLE recovery_codes
+(
+    id         serial primary key                          not null unique,
+    user_id    int references users (id) on delete cascade not null,
+    code_hash  varchar(64)                                 not null,
+    used_at    timestamptz,
+    created_at timestamptz                                 not null default now()
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE personal_access_tokens
+(
+    id           serial primary key                          not null unique,
+    user_id      int references users (id) on delete cascade not null,
+    name         varchar(255)                                not null,
+    token_prefix varchar(16)                                 not null,
+    token_hash   varchar(64)                                 not null unique,
+    scopes       text[]                                      not null,
+    expires_at   timestamptz,
+    last_used_at timestamptz,
+    revoked_at   timestamptz,
+    created_at   timestamptz                                 not null default now()
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
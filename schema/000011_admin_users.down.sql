@@ -0,0 +1,5 @@
+ALTER TABLE auth_audit_log
+    DROP COLUMN actor_id;
+
+ALTER TABLE users
+    DROP COLUMN disabled_at;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN disabled_at timestamptz;
+
+ALTER TABLE auth_audit_log
+    ADD COLUMN actor_id int references users (id) on delete set null;
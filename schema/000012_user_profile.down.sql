@@ -0,0 +1,7 @@
+DROP INDEX users_delete_after_idx;
+
+ALTER TABLE users
+    DROP COLUMN timezone,
+    DROP COLUMN locale,
+    DROP COLUMN preferences,
+    DROP COLUMN delete_after;
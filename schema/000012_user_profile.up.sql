@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN timezone     varchar(64) not null default 'UTC',
+    ADD COLUMN locale       varchar(35) not null default 'en',
+    ADD COLUMN preferences  jsonb       not null default '{}',
+    ADD COLUMN delete_after timestamptz;
+
+CREATE INDEX users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE data_exports
+(
+    id           serial primary key                          not null unique,
+    -- set null rather than cascade, so archives of deleted users are still found and removed when they expire
+    user_id      int references users (id) on delete set null,
+    status       varchar(16)                                 not null default 'pending',
+    file_key     varchar(255)                                not null default '',
+    error        text                                        not null default '',
+    created_at   timestamptz                                 not null default now(),
+    completed_at timestamptz,
+    expires_at   timestamptz
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
@@ -0,0 +1,20 @@
+-- usernames were never unique; refuse to migrate until duplicates are resolved by hand
+DO
+$$
+    DECLARE
+        duplicates text;
+    BEGIN
+        SELECT string_agg(format('%s (ids %s)', name, ids), '; ')
+        INTO duplicates
+        FROM (SELECT lower(username) AS name, string_agg(id::text, ', ' ORDER BY id) AS ids
+              FROM users
+              GROUP BY lower(username)
+              HAVING count(*) > 1) d;
+
+        IF duplicates IS NOT NULL THEN
+            RAISE EXCEPTION 'duplicate usernames must be renamed before they can be made unique: %', duplicates;
+        END IF;
+    END
+$$;
+
+CREATE UNIQUE INDEX users_username_idx ON users (lower(username));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS webhook_deliveries_next_attempt_at_idx;
+
+ALTER TABLE webhook_deliveries
+    DROP COLUMN IF EXISTS next_attempt_at;
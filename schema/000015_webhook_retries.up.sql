@@ -0,0 +1,10 @@
+ALTER TABLE webhook_deliveries
+    ADD COLUMN next_attempt_at timestamptz;
+
+-- deliveries left pending by the in-process retries are picked up right away
+UPDATE webhook_deliveries
+SET next_attempt_at = now()
+WHERE status = 'pending';
+
+CREATE INDEX webhook_deliveries_next_attempt_at_idx ON webhook_deliveries (next_attempt_at)
+    WHERE status = 'pending';
@@ -0,0 +1,14 @@
+DROP TRIGGER todo_items_assign_revision ON todo_items;
+
+CREATE OR REPLACE FUNCTION todo_items_bump_revision() RETURNS trigger AS
+$$
+BEGIN
+    NEW.version := OLD.version + 1;
+    NEW.revision := nextval('todo_items_revision_seq');
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE todo_items
+    ALTER COLUMN revision SET DEFAULT nextval('todo_items_revision_seq');
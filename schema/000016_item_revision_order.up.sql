@@ -0,0 +1,26 @@
+-- Revisions of a user's items are handed out one transaction at a time: the
+-- trigger takes a per-user lock held until commit before calling nextval. A
+-- revision then only becomes visible after every smaller one of the same
+-- user, so a sync token never moves past a write still to be committed.
+ALTER TABLE todo_items
+    ALTER COLUMN revision DROP DEFAULT;
+
+CREATE OR REPLACE FUNCTION todo_items_bump_revision() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(7311542, NEW.user_id);
+
+    IF TG_OP = 'UPDATE' THEN
+        NEW.version := OLD.version + 1;
+        NEW.updated_at := now();
+    END IF;
+    NEW.revision := nextval('todo_items_revision_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todo_items_assign_revision
+    BEFORE INSERT
+    ON todo_items
+    FOR EACH ROW
+EXECUTE PROCEDURE todo_items_bump_revision();
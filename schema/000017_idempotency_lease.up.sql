@@ -0,0 +1,6 @@
+-- A reservation is only held while its request runs: once locked_until has
+-- passed, a retry of the same request takes it over. lock_token tells the
+-- request holding it apart from one that took it over.
+ALTER TABLE idempotency_keys
+    ADD COLUMN lock_token   varchar(64) not null default '',
+    ADD COLUMN locked_until timestamp;
@@ -0,0 +1,3 @@
+ALTER TABLE todo_items
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN updated_at TYPE timestamp USING updated_at AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,7 @@
+-- Sync compares updated_at with the UTC times clients send, so it has to be
+-- an instant rather than a wall-clock time in the session's TimeZone. The
+-- existing values were written by now() in that TimeZone, which is how the
+-- conversion reads them.
+ALTER TABLE todo_items
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN updated_at TYPE timestamptz USING updated_at AT TIME ZONE current_setting('TimeZone');
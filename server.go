@@ -2,26 +2,57 @@ package todo
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"time"
 )
 
+type ServerConfig struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
 type Server struct {
 	httpServer *http.Server
+	// cancel ends the contexts of requests still running when Shutdown gives up.
+	cancel context.CancelFunc
 }
 
-func (s *Server) Run(port string, handler http.Handler) error {
-	s.httpServer = &http.Server{
-		Addr:           ":" + port,
-		Handler:        handler,
-		MaxHeaderBytes: 1 << 20, // 1 MB
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+// NewServer prepares the server; it's ready for Shutdown before Run starts,
+// so a signal arriving early doesn't race with Run.
+func NewServer(port string, handler http.Handler, cfg ServerConfig) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		httpServer: &http.Server{
+			Addr:           ":" + port,
+			Handler:        handler,
+			MaxHeaderBytes: 1 << 20, // 1 MB
+			ReadTimeout:    cfg.ReadTimeout,
+			WriteTimeout:   cfg.WriteTimeout,
+			BaseContext: func(net.Listener) context.Context {
+				return ctx
+			},
+		},
+		cancel: cancel,
 	}
+}
 
+// Run serves until Shutdown; it then returns http.ErrServerClosed.
+func (s *Server) Run() error {
 	return s.httpServer.ListenAndServe()
 }
 
+// Shutdown stops accepting connections and waits for requests in flight
+// until ctx is done. Then it cancels the contexts of the ones left, so their
+// queries stop, and closes their connections.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	defer s.cancel()
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		s.cancel()
+		_ = s.httpServer.Close()
+	}
+
+	return err
 }